@@ -8,19 +8,343 @@ import (
 	"path/filepath"
 	"strconv"
 	"strings"
+	"sync"
 )
 
+// CgroupHierarchy is the layout of the cgroup filesystem mounted at paths.cgroup.
+type CgroupHierarchy int
+
+const (
+	// CgroupV2 is the unified cgroup v2 hierarchy mounted at the cgroup root.
+	CgroupV2 CgroupHierarchy = iota
+	// CgroupV1 has a separate cgroup v1 hierarchy mounted for each controller under the cgroup root,
+	// e.g. <root>/memory and <root>/cpu.
+	CgroupV1
+	// CgroupHybrid is like CgroupV1, but additionally has the cgroup v2 hierarchy mounted at <root>/unified.
+	// Controllers are bound to the v1 hierarchies, so the resource metrics are read from them.
+	CgroupHybrid
+)
+
+func (h CgroupHierarchy) String() string {
+	switch h {
+	case CgroupV2:
+		return "v2"
+	case CgroupV1:
+		return "v1"
+	case CgroupHybrid:
+		return "hybrid"
+	}
+	return "unknown"
+}
+
+// DetectCgroupHierarchy detects whether cgroup v2, v1 or hybrid hierarchy is mounted at the cgroup root.
+func DetectCgroupHierarchy(root string) (CgroupHierarchy, error) {
+	if _, err := os.Stat(filepath.Join(root, "cgroup.controllers")); err == nil {
+		return CgroupV2, nil
+	}
+
+	if _, err := os.Stat(filepath.Join(root, "memory")); err != nil {
+		return 0, fmt.Errorf("neither cgroup v2 nor cgroup v1 memory controller found under %s", root)
+	}
+
+	if _, err := os.Stat(filepath.Join(root, "unified", "cgroup.controllers")); err == nil {
+		return CgroupHybrid, nil
+	}
+	return CgroupV1, nil
+}
+
+// dir returns the directory where the hierarchy of the given controller is mounted.
+// The controller is the prefix of the cgroup interface file names, e.g. "memory" for "memory.stat".
+func (h CgroupHierarchy) dir(root, controller string) string {
+	switch {
+	case h == CgroupV2:
+		return root
+	case h == CgroupHybrid && controller == "cgroup":
+		return filepath.Join(root, "unified")
+	case controller == "cgroup":
+		// The core interface files exist in every v1 hierarchy.
+		return filepath.Join(root, "memory")
+	}
+	return filepath.Join(root, controller)
+}
+
+// CGroup is the cgroup of a container.
 type CGroup struct {
-	path string
+	root      string
+	path      string // Relative to the cgroup root, or to the controller hierarchy on cgroup v1.
+	hierarchy CgroupHierarchy
+}
+
+// dir returns the cgroup directory in the hierarchy of the controller.
+func (c *CGroup) dir(controller string) string {
+	return filepath.Join(c.hierarchy.dir(c.root, controller), c.path)
+}
+
+// filePath returns the path of the cgroup interface file.
+func (c *CGroup) filePath(fileName string) string {
+	controller, _, _ := strings.Cut(fileName, ".")
+	return filepath.Join(c.dir(controller), fileName)
+}
+
+// parent returns the parent cgroup.
+func (c *CGroup) parent() *CGroup {
+	return &CGroup{root: c.root, path: filepath.Dir(c.path), hierarchy: c.hierarchy}
+}
+
+// Subcgroups returns the paths of the descendant cgroups relative to the cgroup, down to the given depth.
+// Children of the cgroup are at depth 1.
+func (c *CGroup) Subcgroups(depth int) ([]string, error) {
+	// On cgroup v1 the memory hierarchy is walked, like when resolving the cgroup.
+	base := c.dir("memory")
+
+	var subcgroups []string
+	err := filepath.WalkDir(base, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			// Sub-cgroups can be removed while walking.
+			if path != base && os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if !d.IsDir() || path == base {
+			return nil
+		}
+
+		rel, err := filepath.Rel(base, path)
+		if err != nil {
+			return err
+		}
+		subcgroups = append(subcgroups, rel)
+
+		if strings.Count(rel, string(filepath.Separator))+1 >= depth {
+			return filepath.SkipDir
+		}
+		return nil
+	})
+	return subcgroups, err
+}
+
+// Names of the QoS class cgroups created by kubelet, as used in the level label.
+const (
+	QoSCgroupKubepods   = "kubepods"
+	QoSCgroupBurstable  = "burstable"
+	QoSCgroupBestEffort = "besteffort"
+)
+
+// qosCgroupLevel returns the QoS class of a cgroup directory name, or an empty string if the cgroup is not
+// a QoS class cgroup. Kubelet names the cgroups, for example, kubepods-burstable.slice with the systemd
+// cgroup driver and burstable with the cgroupfs driver.
+func qosCgroupLevel(name string) string {
+	switch name {
+	case "kubepods.slice", "kubepods":
+		return QoSCgroupKubepods
+	case "kubepods-burstable.slice", "burstable":
+		return QoSCgroupBurstable
+	case "kubepods-besteffort.slice", "besteffort":
+		return QoSCgroupBestEffort
+	}
+	return ""
+}
+
+// isPodCgroup returns true if the cgroup directory name is a pod cgroup created by kubelet, such as
+// kubepods-burstable-pod<uid>.slice with the systemd cgroup driver or pod<uid> with the cgroupfs driver.
+func isPodCgroup(name string) bool {
+	return strings.HasPrefix(name, "pod") || strings.Contains(name, "-pod")
+}
+
+// CgroupResolver resolves the cgroup of each container and caches it by container ID.
+//
+// The cgroup is resolved, in order of preference, from:
+//  1. /proc/<pid>/cgroup of a process in the container (Container.ProcCgroup).
+//  2. The cgroupsPath of the OCI runtime spec returned by the CRI ContainerStatus verbose info,
+//     looked up by ContainerInventory when the container is discovered (Container.CRICgroupPath).
+//  3. Walking the cgroup filesystem with FindCgroup.
+type CgroupResolver struct {
+	mu        sync.Mutex
+	root      string
+	hierarchy CgroupHierarchy
+	cache     map[string]*CGroup
+}
+
+func NewCgroupResolver(root string, hierarchy CgroupHierarchy) *CgroupResolver {
+	return &CgroupResolver{
+		root:      root,
+		hierarchy: hierarchy,
+		cache:     make(map[string]*CGroup),
+	}
+}
+
+// Resolve returns the cgroup of the container.
+func (r *CgroupResolver) Resolve(container Container) (*CGroup, error) {
+	r.mu.Lock()
+	cgroup, found := r.cache[container.ID]
+	r.mu.Unlock()
+	if found {
+		return cgroup, nil
+	}
+
+	cgroup, source, err := r.resolve(container)
+	if err != nil {
+		return nil, err
+	}
+	slog.Debug("Resolved container cgroup", "container", container.Container, "id", container.ID, "path", cgroup.path, "source", source)
+
+	r.mu.Lock()
+	r.cache[container.ID] = cgroup
+	r.mu.Unlock()
+
+	return cgroup, nil
+}
+
+func (r *CgroupResolver) resolve(container Container) (*CGroup, string, error) {
+	if cgroup, ok := r.lookup(parseCgroupPath(container.ProcCgroup, r.hierarchy), container.ID); ok {
+		return cgroup, "proc", nil
+	}
+
+	if cgroup, ok := r.lookup(container.CRICgroupPath, container.ID); ok {
+		return cgroup, "cri", nil
+	}
+
+	searchPath := r.hierarchy.dir(r.root, "memory")
+	found, err := FindCgroup(searchPath, container.ID)
+	if err != nil {
+		return nil, "", err
+	}
+	relPath, err := filepath.Rel(searchPath, found)
+	if err != nil {
+		return nil, "", err
+	}
+	return r.newCgroup("/" + relPath), "walk", nil
+}
+
+// lookup checks that the cgroup path relative to the cgroup root exists and belongs to the container.
+// The path is cut at the container cgroup, since the process it was read from may be in a child cgroup
+// of the container cgroup, e.g. when running systemd in the container.
+func (r *CgroupResolver) lookup(relPath, id string) (*CGroup, bool) {
+	// Paths containing ".." are relative to a different cgroup namespace than the one of the root.
+	if strings.Contains(relPath, "..") {
+		return nil, false
+	}
+	relPath = containerCgroupPath(relPath, id)
+	if relPath == "" {
+		return nil, false
+	}
+
+	path := filepath.Join(r.hierarchy.dir(r.root, "memory"), relPath)
+	if info, err := os.Stat(path); err != nil || !info.IsDir() {
+		return nil, false
+	}
+	return r.newCgroup(relPath), true
+}
+
+// containerCgroupPath returns the cgroup path up to the last component that is the cgroup of the container
+// with the given ID, or an empty string if the path does not contain the container cgroup.
+func containerCgroupPath(relPath, id string) string {
+	components := strings.Split(relPath, "/")
+	for i := len(components) - 1; i >= 0; i-- {
+		if cgroupContainerID(components[i]) == id {
+			return strings.Join(components[:i+1], "/")
+		}
+	}
+	return ""
+}
+
+func (r *CgroupResolver) newCgroup(relPath string) *CGroup {
+	return &CGroup{root: r.root, path: relPath, hierarchy: r.hierarchy}
+}
+
+// Cgroups returns the cached cgroups of the containers.
+func (r *CgroupResolver) Cgroups() []*CGroup {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	cgroups := make([]*CGroup, 0, len(r.cache))
+	for _, cgroup := range r.cache {
+		cgroups = append(cgroups, cgroup)
+	}
+	return cgroups
+}
+
+// Retain drops cached cgroups of containers that are not in the given list.
+func (r *CgroupResolver) Retain(containers []Container) {
+	live := make(map[string]bool, len(containers))
+	for _, c := range containers {
+		live[c.ID] = true
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for id := range r.cache {
+		if !live[id] {
+			delete(r.cache, id)
+		}
+	}
+}
+
+// parseCgroupPath returns the cgroup path from the contents of /proc/<pid>/cgroup.
+// On cgroup v2 it is read from the "0::<path>" line. On cgroup v1 and hybrid it is read from the line of
+// the memory controller, e.g. "4:memory:<path>", since kubelet uses the same path for all controllers.
+func parseCgroupPath(data string, hierarchy CgroupHierarchy) string {
+	for _, line := range strings.Split(data, "\n") {
+		// hierarchy-ID:controller-list:cgroup-path
+		parts := strings.SplitN(line, ":", 3)
+		if len(parts) != 3 {
+			continue
+		}
+
+		if hierarchy == CgroupV2 {
+			if parts[0] == "0" && parts[1] == "" {
+				return strings.TrimSpace(parts[2])
+			}
+			continue
+		}
+
+		for _, controller := range strings.Split(parts[1], ",") {
+			if controller == "memory" {
+				return strings.TrimSpace(parts[2])
+			}
+		}
+	}
+	return ""
 }
 
-// FindCgroup searches cgroupv2 directories recursively under the given host root path
-// for a directory name that contains the specified container ID and ends with ".scope".
+// systemdCgroupPath converts the cgroupsPath of the OCI runtime spec to a path relative to
+// the cgroup root. With the systemd cgroup driver, the path has the form "slice:prefix:name",
+// e.g. "kubepods-besteffort-pod<uid>.slice:cri-containerd:<id>", which systemd places at
+// "kubepods.slice/kubepods-besteffort.slice/kubepods-besteffort-pod<uid>.slice/cri-containerd-<id>.scope".
+// With the cgroupfs driver, the path is returned as-is.
+func systemdCgroupPath(cgroupsPath string) string {
+	parts := strings.Split(cgroupsPath, ":")
+	if len(parts) != 3 {
+		return cgroupsPath
+	}
+	slice, prefix, name := parts[0], parts[1], parts[2]
+
+	// Each dash-separated component of the slice name is a parent slice.
+	var dirs []string
+	if slice != "" && slice != "-.slice" {
+		components := strings.Split(strings.TrimSuffix(slice, ".slice"), "-")
+		for i := range components {
+			dirs = append(dirs, strings.Join(components[:i+1], "-")+".slice")
+		}
+	}
+
+	scope := name + ".scope"
+	if prefix != "" {
+		scope = prefix + "-" + scope
+	}
+
+	return "/" + filepath.Join(append(dirs, scope)...)
+}
+
+// FindCgroup searches cgroup directories recursively under the given path for the cgroup of the
+// container with the specified ID, named as described in cgroupContainerID. It returns the path of
+// the found directory.
 //
-// cgroupv2RootPath: The path of the cgroup v2 filesystem.
+// searchPath: The path of the cgroup v2 filesystem, or the cgroup v1 controller hierarchy.
 // id: The ID to search for in the cgroup directory names.
-func FindCgroup(cgroupv2RootPath, id string) (*CGroup, error) {
-	searchPath := cgroupv2RootPath
+func FindCgroup(searchPath, id string) (string, error) {
 	slog.Debug("Searching for cgroup sandbox", "id", id, "searchPath", searchPath)
 
 	// Recursively search for the cgroup path matching the container ID.
@@ -29,19 +353,19 @@ func FindCgroup(cgroupv2RootPath, id string) (*CGroup, error) {
 		if err != nil {
 			return err
 		}
-		if d.IsDir() && strings.Contains(d.Name(), id) && strings.HasSuffix(d.Name(), ".scope") {
+		if d.IsDir() && cgroupContainerID(d.Name()) == id {
 			directories = append(directories, path)
 			return filepath.SkipDir
 		}
 		return nil
 	})
 	if err != nil {
-		return nil, fmt.Errorf("error searching cgroup path: %w", err)
+		return "", fmt.Errorf("error searching cgroup path: %w", err)
 	}
 
 	if len(directories) == 0 {
 		slog.Debug("No cgroup directories found", "id", id, "searchPath", searchPath)
-		return nil, fmt.Errorf("cgroup path not found for id: %s", id)
+		return "", fmt.Errorf("cgroup path not found for id: %s", id)
 	}
 
 	// TODO: Maybe this approach is too simple? Just pick the first one if multiple are found.
@@ -52,40 +376,48 @@ func FindCgroup(cgroupv2RootPath, id string) (*CGroup, error) {
 
 	if found == "" {
 		slog.Debug("Cgroup path not found", "id", id, "searchPath", searchPath)
-		return nil, fmt.Errorf("cgroup path not found for id: %s", id)
+		return "", fmt.Errorf("cgroup path not found for id: %s", id)
 	}
 
 	slog.Debug("Cgroup path found", "path", found)
-	return &CGroup{path: found}, nil
+	return found, nil
 }
 
-// ReadInteger reads the content of the specified file within the cgroup directory.
-func (c *CGroup) ReadInteger(fileName string) (int, error) {
-	slog.Debug("Reading cgroup file", "path", filepath.Join(c.path, fileName))
-	rawData, err := os.ReadFile(filepath.Join(c.path, fileName))
+// ReadIntegerValues reads the space-separated values on the single line of the specified file within
+// the cgroup directory. Most files such as memory.current contain a single value, while some such as
+// cpu.max ("max 100000") contain several. A value of "max" is returned as -1 to indicate no limit.
+func (c *CGroup) ReadIntegerValues(fileName string) ([]int, error) {
+	slog.Debug("Reading cgroup file", "path", c.filePath(fileName))
+	rawData, err := os.ReadFile(c.filePath(fileName))
 	if err != nil {
-		return 0, fmt.Errorf("error reading cgroup file: %w", err)
+		return nil, fmt.Errorf("error reading cgroup file: %w", err)
 	}
 
 	data := strings.TrimSpace(string(rawData))
 	slog.Debug("Cgroup file data", "file", fileName, "data", data)
 
-	if data == "max" {
-		return -1, nil // Indicate no limit with -1
-	}
+	fields := strings.Fields(data)
+	values := make([]int, 0, len(fields))
+	for _, field := range fields {
+		if field == "max" {
+			values = append(values, -1) // Indicate no limit with -1
+			continue
+		}
 
-	value, err := strconv.Atoi(string(data))
-	if err != nil {
-		return 0, fmt.Errorf("error converting cgroup file data to int: %w", err)
+		value, err := strconv.Atoi(field)
+		if err != nil {
+			return nil, fmt.Errorf("error converting cgroup file data to int: %w", err)
+		}
+		values = append(values, value)
 	}
 
-	return value, nil
+	return values, nil
 }
 
 // ReadIntegerField reads a specific field from a cgroup file that contains key-value pairs.
 func (c *CGroup) ReadIntegerField(fileName, field string) (int, error) {
-	slog.Debug("Reading cgroup file field", "path", filepath.Join(c.path, fileName), "field", field)
-	rawData, err := os.ReadFile(filepath.Join(c.path, fileName))
+	slog.Debug("Reading cgroup file field", "path", c.filePath(fileName), "field", field)
+	rawData, err := os.ReadFile(c.filePath(fileName))
 	if err != nil {
 		return 0, err
 	}
@@ -103,3 +435,250 @@ func (c *CGroup) ReadIntegerField(fileName, field string) (int, error) {
 	slog.Debug("Cgroup file field not found", "file", fileName, "field", field)
 	return 0, fmt.Errorf("field %s not found in file %s", field, fileName)
 }
+
+// HugePageSizes lists the huge page sizes supported by the kernel from /sys/kernel/mm/hugepages, named as in
+// the hugetlb controller files, such as "2MB" and "1GB".
+func HugePageSizes(sysPath string) ([]string, error) {
+	entries, err := os.ReadDir(filepath.Join(sysPath, "kernel", "mm", "hugepages"))
+	if err != nil {
+		return nil, err
+	}
+
+	var sizes []string
+	for _, entry := range entries {
+		// hugepages-<size>kB
+		name, found := strings.CutPrefix(entry.Name(), "hugepages-")
+		if !found {
+			continue
+		}
+		name, found = strings.CutSuffix(name, "kB")
+		if !found {
+			continue
+		}
+		kB, err := strconv.Atoi(name)
+		if err != nil {
+			continue
+		}
+		sizes = append(sizes, hugePageSizeName(kB))
+	}
+
+	return sizes, nil
+}
+
+// hugePageSizeName formats the huge page size in kB like the kernel does in the hugetlb controller file names.
+func hugePageSizeName(kB int) string {
+	switch {
+	case kB >= 1<<20:
+		return fmt.Sprintf("%dGB", kB>>20)
+	case kB >= 1<<10:
+		return fmt.Sprintf("%dMB", kB>>10)
+	}
+	return fmt.Sprintf("%dKB", kB)
+}
+
+// ReadString reads the content of the specified file within the cgroup directory, with surrounding whitespace removed.
+func (c *CGroup) ReadString(fileName string) (string, error) {
+	slog.Debug("Reading cgroup file", "path", c.filePath(fileName))
+	rawData, err := os.ReadFile(c.filePath(fileName))
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(rawData)), nil
+}
+
+// ReadNUMAStat reads memory.numa_stat within the cgroup directory. The file has a line per memory type,
+// with the amount for each NUMA node:
+//
+//	anon N0=1073741824 N1=536870912
+//
+// The result is keyed by the memory type and the NUMA node number.
+func (c *CGroup) ReadNUMAStat(fileName string) (map[string]map[string]uint64, error) {
+	slog.Debug("Reading cgroup NUMA stat file", "path", c.filePath(fileName))
+	rawData, err := os.ReadFile(c.filePath(fileName))
+	if err != nil {
+		return nil, err
+	}
+
+	result := make(map[string]map[string]uint64)
+	for _, line := range strings.Split(string(rawData), "\n") {
+		parts := strings.Fields(line)
+		if len(parts) == 0 {
+			continue
+		}
+
+		nodes := make(map[string]uint64, len(parts)-1)
+		for _, kv := range parts[1:] {
+			key, value, found := strings.Cut(kv, "=")
+			node, isNode := strings.CutPrefix(key, "N")
+			if !found || !isNode {
+				return nil, fmt.Errorf("invalid field %q in file %s", kv, fileName)
+			}
+			v, err := strconv.ParseUint(value, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("error parsing field %q in file %s: %w", kv, fileName, err)
+			}
+			nodes[node] = v
+		}
+
+		result[parts[0]] = nodes
+	}
+
+	return result, nil
+}
+
+// ReadKeyValues reads all fields of a cgroup file that contains key-value pairs, such as memory.stat.
+func (c *CGroup) ReadKeyValues(fileName string) (map[string]uint64, error) {
+	slog.Debug("Reading cgroup file fields", "path", c.filePath(fileName))
+	rawData, err := os.ReadFile(c.filePath(fileName))
+	if err != nil {
+		return nil, err
+	}
+
+	result := make(map[string]uint64)
+	for _, line := range strings.Split(string(rawData), "\n") {
+		parts := strings.Fields(line)
+		if len(parts) != 2 {
+			continue
+		}
+		value, err := strconv.ParseUint(parts[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing field %s in file %s: %w", parts[0], fileName, err)
+		}
+		result[parts[0]] = value
+	}
+
+	return result, nil
+}
+
+// PressureStats holds one line of a Pressure Stall Information (PSI) file.
+type PressureStats struct {
+	// Percentage of time in which tasks were stalled, averaged over 10, 60 and 300 second windows.
+	Avg10  float64
+	Avg60  float64
+	Avg300 float64
+	// Total stall time in microseconds.
+	Total uint64
+}
+
+// ReadPressure reads a Pressure Stall Information file such as cpu.pressure within the cgroup directory.
+// The file has a line per kind of stall, keyed by "some" or "full":
+//
+//	some avg10=0.00 avg60=0.00 avg300=0.00 total=0
+//	full avg10=0.00 avg60=0.00 avg300=0.00 total=0
+func (c *CGroup) ReadPressure(fileName string) (map[string]PressureStats, error) {
+	slog.Debug("Reading cgroup pressure file", "path", c.filePath(fileName))
+	rawData, err := os.ReadFile(c.filePath(fileName))
+	if err != nil {
+		return nil, err
+	}
+
+	result := make(map[string]PressureStats)
+	for _, line := range strings.Split(string(rawData), "\n") {
+		parts := strings.Fields(line)
+		if len(parts) == 0 {
+			continue
+		}
+
+		var stats PressureStats
+		for _, kv := range parts[1:] {
+			key, value, found := strings.Cut(kv, "=")
+			if !found {
+				return nil, fmt.Errorf("invalid field %q in file %s", kv, fileName)
+			}
+
+			switch key {
+			case "avg10":
+				stats.Avg10, err = strconv.ParseFloat(value, 64)
+			case "avg60":
+				stats.Avg60, err = strconv.ParseFloat(value, 64)
+			case "avg300":
+				stats.Avg300, err = strconv.ParseFloat(value, 64)
+			case "total":
+				stats.Total, err = strconv.ParseUint(value, 10, 64)
+			}
+			if err != nil {
+				return nil, fmt.Errorf("error parsing field %q in file %s: %w", kv, fileName, err)
+			}
+		}
+
+		result[parts[0]] = stats
+	}
+
+	slog.Debug("Cgroup pressure file data", "file", fileName, "data", result)
+	return result, nil
+}
+
+// ReadIOStat reads io.stat within the cgroup directory. The file has a line per device:
+//
+//	8:16 rbytes=1459200 wbytes=314773504 rios=192 wios=353 dbytes=0 dios=0
+//
+// The result is keyed by the device number "MAJ:MIN" and the field name.
+func (c *CGroup) ReadIOStat(fileName string) (map[string]map[string]uint64, error) {
+	slog.Debug("Reading cgroup io stat file", "path", c.filePath(fileName))
+	rawData, err := os.ReadFile(c.filePath(fileName))
+	if err != nil {
+		return nil, err
+	}
+
+	result := make(map[string]map[string]uint64)
+	for _, line := range strings.Split(string(rawData), "\n") {
+		parts := strings.Fields(line)
+		if len(parts) == 0 {
+			continue
+		}
+
+		fields := make(map[string]uint64, len(parts)-1)
+		for _, kv := range parts[1:] {
+			key, value, found := strings.Cut(kv, "=")
+			if !found {
+				continue
+			}
+			v, err := strconv.ParseUint(value, 10, 64)
+			if err != nil {
+				continue // Skip non-integer fields, e.g. ones added by io.cost.
+			}
+			fields[key] = v
+		}
+
+		result[parts[0]] = fields
+	}
+
+	return result, nil
+}
+
+// BlockDevices resolves block device numbers to device names using /sys/dev/block, caching the results.
+type BlockDevices struct {
+	mu      sync.Mutex
+	sysPath string
+	names   map[string]string
+}
+
+func NewBlockDevices(sysPath string) *BlockDevices {
+	return &BlockDevices{
+		sysPath: sysPath,
+		names:   make(map[string]string),
+	}
+}
+
+// Name returns the device name such as "sda" for the device number "MAJ:MIN".
+// If the name cannot be resolved, the device number is returned.
+func (b *BlockDevices) Name(device string) string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if name, found := b.names[device]; found {
+		return name
+	}
+
+	// /sys/dev/block/8:0 -> ../../devices/pci0000:00/0000:00:10.0/.../block/sda
+	name := device
+	target, err := os.Readlink(filepath.Join(b.sysPath, "dev", "block", device))
+	if err != nil {
+		slog.Debug("Failed to resolve block device name", "device", device, "error", err)
+	} else {
+		name = filepath.Base(target)
+	}
+
+	b.names[device] = name
+	return name
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestHugePageSizes(t *testing.T) {
+	sys := t.TempDir()
+	for _, dir := range []string{"hugepages-64kB", "hugepages-2048kB", "hugepages-1048576kB"} {
+		if err := os.MkdirAll(filepath.Join(sys, "kernel", "mm", "hugepages", dir), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	sizes, err := HugePageSizes(sys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"1GB", "2MB", "64KB"}; !reflect.DeepEqual(sizes, want) {
+		t.Errorf("HugePageSizes() = %v, want %v", sizes, want)
+	}
+}
+
+// testCgroup returns a cgroup v2 cgroup whose file has the given contents.
+func testCgroup(t *testing.T, fileName, data string) *CGroup {
+	t.Helper()
+	root := t.TempDir()
+	if err := os.WriteFile(filepath.Join(root, fileName), []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return &CGroup{root: root, path: "/", hierarchy: CgroupV2}
+}
+
+func TestReadPressure(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		want    map[string]PressureStats
+		wantErr bool
+	}{
+		{
+			name: "some and full",
+			data: "some avg10=1.50 avg60=0.75 avg300=0.25 total=123456\nfull avg10=0.00 avg60=0.00 avg300=0.00 total=42\n",
+			want: map[string]PressureStats{
+				"some": {Avg10: 1.5, Avg60: 0.75, Avg300: 0.25, Total: 123456},
+				"full": {Total: 42},
+			},
+		},
+		{
+			name: "some only",
+			data: "some avg10=0.00 avg60=0.00 avg300=0.00 total=7\n",
+			want: map[string]PressureStats{"some": {Total: 7}},
+		},
+		{
+			name: "unknown field",
+			data: "some avg10=0.00 avg60=0.00 avg300=0.00 total=7 avg600=0.00\n",
+			want: map[string]PressureStats{"some": {Total: 7}},
+		},
+		{
+			name: "empty",
+			data: "",
+			want: map[string]PressureStats{},
+		},
+		{
+			name:    "missing value",
+			data:    "some avg10 total=7\n",
+			wantErr: true,
+		},
+		{
+			name:    "invalid total",
+			data:    "some avg10=0.00 avg60=0.00 avg300=0.00 total=-1\n",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := testCgroup(t, "cpu.pressure", tt.data).ReadPressure("cpu.pressure")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ReadPressure() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ReadPressure() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadIOStat(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want map[string]map[string]uint64
+	}{
+		{
+			name: "devices",
+			data: "8:16 rbytes=1459200 wbytes=314773504 rios=192 wios=353 dbytes=0 dios=0\n" +
+				"253:0 rbytes=4096 wbytes=0 rios=1 wios=0 dbytes=0 dios=0\n",
+			want: map[string]map[string]uint64{
+				"8:16":  {"rbytes": 1459200, "wbytes": 314773504, "rios": 192, "wios": 353, "dbytes": 0, "dios": 0},
+				"253:0": {"rbytes": 4096, "wbytes": 0, "rios": 1, "wios": 0, "dbytes": 0, "dios": 0},
+			},
+		},
+		{
+			name: "io.cost fields",
+			data: "8:0 rbytes=512 wbytes=1024 rios=1 wios=2 dbytes=0 dios=0 cost.vrate=135.04 cost.usage=8 cost.wait=0 cost.indebt=0 cost.indelay=0\n",
+			want: map[string]map[string]uint64{
+				"8:0": {"rbytes": 512, "wbytes": 1024, "rios": 1, "wios": 2, "dbytes": 0, "dios": 0,
+					"cost.usage": 8, "cost.wait": 0, "cost.indebt": 0, "cost.indelay": 0},
+			},
+		},
+		{
+			name: "field without value",
+			data: "8:0 rbytes=512 unknown\n",
+			want: map[string]map[string]uint64{"8:0": {"rbytes": 512}},
+		},
+		{
+			name: "empty",
+			data: "",
+			want: map[string]map[string]uint64{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := testCgroup(t, "io.stat", tt.data).ReadIOStat("io.stat")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ReadIOStat() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadNUMAStat(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		want    map[string]map[string]uint64
+		wantErr bool
+	}{
+		{
+			name: "two nodes",
+			data: "anon N0=1073741824 N1=536870912\nfile N0=4096 N1=0\n",
+			want: map[string]map[string]uint64{
+				"anon": {"0": 1073741824, "1": 536870912},
+				"file": {"0": 4096, "1": 0},
+			},
+		},
+		{
+			name: "single node",
+			data: "anon N0=8192\n",
+			want: map[string]map[string]uint64{"anon": {"0": 8192}},
+		},
+		{
+			name: "empty",
+			data: "",
+			want: map[string]map[string]uint64{},
+		},
+		{
+			name:    "not a node",
+			data:    "anon total=12 N0=12\n",
+			wantErr: true,
+		},
+		{
+			name:    "invalid value",
+			data:    "anon N0=-1\n",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := testCgroup(t, "memory.numa_stat", tt.data).ReadNUMAStat("memory.numa_stat")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ReadNUMAStat() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ReadNUMAStat() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -2,22 +2,90 @@ package main
 
 import (
 	"context"
+	"fmt"
 	"log/slog"
 	"os"
 	"path/filepath"
 	"strconv"
+	"sync"
 	"time"
+	"unicode/utf8"
+
+	"github.com/prometheus/client_golang/prometheus"
 )
 
+// Collector reads cgroup and smaps metrics for the discovered containers and exports them
+// by implementing prometheus.Collector.
+//
+// In interval mode, Start collects metrics periodically and scrapes return the latest values.
+// In on_scrape mode, metrics are collected during the scrape itself. Collections are serialized
+// and the result is reused if it is younger than min_collection_age, so that concurrent scrapes
+// e.g. from a HA Prometheus pair do not multiply the cost.
 type Collector struct {
 	kubeClient *KubernetesClient
 	config     *Config
+	cgroups    *CgroupCollector
+	metrics    []Metric
+	resolver   *CgroupResolver
+	devices    *BlockDevices
+
+	// Huge page sizes supported by the kernel, discovered once from /sys/kernel/mm/hugepages.
+	hugePageSizes       []string
+	cgroupSeries        *SeriesTracker
+	smaps               *SmapsMetrics
+	pathRules           []PathRule
+	smapsSeries         *SeriesTracker
+	smapsRollup         *SmapsRollupMetrics
+	smapsRollupSeries   *SeriesTracker
+	processStatus       *ProcessStatusCollector
+	processStatusSeries *SeriesTracker
+
+	// smapsCycles counts the collections for reading full smaps every smaps_full_every collections in hybrid mode.
+	smapsCycles int
+
+	// events triggers a cgroup metric collection when cgroup.events of a container changes, in interval mode on cgroup v2.
+	events *CgroupEventWatcher
+
+	mu             sync.Mutex
+	lastCollection time.Time
 }
 
-func NewCollector(config *Config, kubeClient *KubernetesClient) *Collector {
+func NewCollector(config *Config, kubeClient *KubernetesClient, hierarchy CgroupHierarchy) *Collector {
+	gracePeriod := config.GetStaleSeriesGracePeriod()
+
+	metrics, unavailable := availableCgroupMetrics(config.GetCgroupMetrics(), hierarchy)
+	if len(unavailable) > 0 {
+		slog.Info("Cgroup metrics not available on this cgroup hierarchy", "hierarchy", hierarchy, "metrics", unavailable)
+	}
+	cgroups := NewCgroupCollector(metrics)
+
+	smaps := NewSmapsMetrics(config.SmapsAggregation)
+	smapsRollup := NewSmapsRollupMetrics()
+
+	processStatus := NewProcessStatusCollector()
+
+	hugePageSizes, err := HugePageSizes(config.Paths.Sys)
+	if err != nil {
+		slog.Debug("Failed to list huge page sizes", "error", err)
+	}
+	slog.Debug("Discovered huge page sizes", "sizes", hugePageSizes)
+
 	return &Collector{
-		kubeClient: kubeClient,
-		config:     config,
+		kubeClient:          kubeClient,
+		config:              config,
+		cgroups:             cgroups,
+		metrics:             metrics,
+		resolver:            NewCgroupResolver(config.Paths.Cgroup, hierarchy),
+		devices:             NewBlockDevices(config.Paths.Sys),
+		hugePageSizes:       hugePageSizes,
+		cgroupSeries:        NewSeriesTracker("cgroup", gracePeriod, cgroups),
+		smaps:               smaps,
+		pathRules:           config.GetPathRules(),
+		smapsSeries:         NewSeriesTracker("smaps", gracePeriod, labelDeleters(smaps.all())...),
+		smapsRollup:         smapsRollup,
+		smapsRollupSeries:   NewSeriesTracker("smaps_rollup", gracePeriod, labelDeleters(smapsRollup.all())...),
+		processStatus:       processStatus,
+		processStatusSeries: NewSeriesTracker("process_status", gracePeriod, processStatus),
 	}
 }
 
@@ -27,8 +95,25 @@ func (c *Collector) Start(ctx context.Context) {
 
 	slog.Info("Starting metric collection", "interval", c.config.ScrapeInterval)
 
+	// React to containers becoming unpopulated or frozen without waiting for the next tick.
+	// The cgroup state metrics are not available on cgroup v1 and hybrid hierarchies.
+	if c.resolver.hierarchy == CgroupV2 {
+		events, err := NewCgroupEventWatcher()
+		if err != nil {
+			slog.Warn("Failed to watch cgroup events, state changes are collected on the next interval", "error", err)
+		} else {
+			events.Start(ctx)
+			c.events = events
+		}
+	}
+
 	// Collect immediately on start
-	c.collect(ctx)
+	c.collect()
+	lastCollection := time.Now()
+
+	// Cgroup event collections are delayed until cgroup_events_min_interval has passed since the
+	// previous collection, so that a burst of events, e.g. while pods are deleted, is collected once.
+	var eventCollection <-chan time.Time
 
 	for {
 		select {
@@ -36,13 +121,74 @@ func (c *Collector) Start(ctx context.Context) {
 			slog.Info("Stopping metric collection")
 			return
 		case <-ticker.C:
-			c.collect(ctx)
+			eventCollection = nil
+			c.collect()
+			lastCollection = time.Now()
+			continue
+		case <-c.eventsChanged():
+			if eventCollection != nil {
+				continue
+			}
+			delay := c.config.GetCgroupEventsMinInterval() - time.Since(lastCollection)
+			if delay > 0 {
+				slog.Debug("Cgroup events changed, delaying collection", "delay", delay)
+				eventCollection = time.After(delay)
+				continue
+			}
+		case <-eventCollection:
 		}
+
+		slog.Debug("Cgroup events changed, collecting cgroup metrics")
+		eventCollection = nil
+		c.collectCgroupEvents()
+		lastCollection = time.Now()
+	}
+}
+
+// Describe implements prometheus.Collector.
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	c.cgroups.Describe(ch)
+	for _, vec := range c.smaps.all() {
+		vec.Describe(ch)
+	}
+	for _, vec := range c.smapsRollup.all() {
+		vec.Describe(ch)
+	}
+	c.processStatus.Describe(ch)
+}
+
+// Collect implements prometheus.Collector.
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	if c.config.CollectionMode == CollectionModeOnScrape {
+		c.collectIfStale()
+	}
+
+	c.cgroups.Collect(ch)
+	for _, vec := range c.smaps.all() {
+		vec.Collect(ch)
+	}
+	for _, vec := range c.smapsRollup.all() {
+		vec.Collect(ch)
+	}
+	c.processStatus.Collect(ch)
+}
+
+// collectIfStale runs a collection cycle unless the previous one is younger than min_collection_age.
+func (c *Collector) collectIfStale() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if age := time.Since(c.lastCollection); age < c.config.GetMinCollectionAge() {
+		slog.Debug("Reusing previous collection", "age", age)
+		return
 	}
+
+	c.collect()
+	c.lastCollection = time.Now()
 }
 
-func (c *Collector) collect(ctx context.Context) {
-	containers, err := c.kubeClient.DiscoverContainers(ctx)
+func (c *Collector) collect() {
+	containers, err := c.kubeClient.DiscoverContainers()
 	if err != nil {
 		slog.Error("Failed to discover containers", "error", err)
 		return
@@ -50,101 +196,712 @@ func (c *Collector) collect(ctx context.Context) {
 
 	if len(containers) == 0 {
 		slog.Warn("No containers found matching filters")
-		return
+	}
+
+	readSmaps, readSmapsRollup := c.smapsModes()
+
+	now := time.Now()
+	c.processStatusSeries.BeginCycle(now)
+	if readSmaps {
+		c.smapsSeries.BeginCycle(now)
+	}
+	if readSmapsRollup {
+		c.smapsRollupSeries.BeginCycle(now)
 	}
 
 	for _, container := range containers {
-		// Collect cgroup metrics
-		c.collectCgroupMetrics(container)
+		// Process status has been read when discovering the processes.
+		c.setProcessStatusMetrics(container)
 
 		// Collect smaps metrics
-		c.collectSmapsMetrics(container)
+		c.collectSmapsMetrics(container, readSmaps, readSmapsRollup)
+	}
+	c.collectCgroups(containers, now)
+
+	// Remove series of processes that have disappeared.
+	c.processStatusSeries.Sweep()
+	if readSmaps {
+		c.smapsSeries.Sweep()
+	}
+	if readSmapsRollup {
+		c.smapsRollupSeries.Sweep()
 	}
 
 	slog.Debug("Metric collection cycle complete", "containers", len(containers))
 }
 
-func (c *Collector) collectCgroupMetrics(container Container) {
-	cgroup, err := FindCgroup(c.config.Paths.Cgroup, container.ID)
+// collectCgroupEvents collects the cgroup metrics after cgroup.events of a container has changed.
+// Processes are not scanned, since the cgroups of the containers are already known.
+func (c *Collector) collectCgroupEvents() {
+	containers, err := c.kubeClient.Containers()
 	if err != nil {
-		slog.Warn("Failed to find cgroup", "container", container.Container, "error", err)
+		slog.Error("Failed to list containers", "error", err)
 		return
 	}
 
-	for _, metric := range cgroupMetrics {
+	c.collectCgroups(containers, time.Now())
+}
+
+// collectCgroups collects the cgroup metrics of the containers, their pods and the node cgroups.
+func (c *Collector) collectCgroups(containers []Container, now time.Time) {
+	c.cgroupSeries.BeginCycle(now)
+
+	samples := make(map[string]cgroupSample, len(containers))
+	pods := make(map[string]Container)
+	for _, container := range containers {
+		for _, sample := range c.collectCgroupMetrics(container) {
+			addCgroupSample(samples, sample)
+		}
+
+		// Remember the newest container of each pod sandbox for the pod cgroup metrics.
+		if existing, found := pods[container.SandboxID]; !found || existing.CreatedAt < container.CreatedAt {
+			pods[container.SandboxID] = container
+		}
+	}
+	c.collectPodCgroupMetrics(pods, samples)
+	c.collectNodeCgroupMetrics(samples)
+	c.resolver.Retain(containers)
+	c.watchCgroupEvents()
+
+	for _, sample := range samples {
+		c.cgroups.Set(sample)
+		c.cgroupSeries.Observe(sample.labels...)
+	}
+
+	// Remove series of containers that have disappeared.
+	c.cgroupSeries.Sweep()
+}
+
+// eventsChanged returns the channel of cgroup events changes, or nil if cgroup events are not watched.
+func (c *Collector) eventsChanged() <-chan struct{} {
+	if c.events == nil {
+		return nil
+	}
+	return c.events.Changed()
+}
+
+// watchCgroupEvents updates the cgroup.events files watched to the cgroups of the current containers.
+func (c *Collector) watchCgroupEvents() {
+	if c.events == nil {
+		return
+	}
+
+	cgroups := c.resolver.Cgroups()
+	paths := make([]string, 0, len(cgroups))
+	for _, cgroup := range cgroups {
+		paths = append(paths, cgroup.filePath("cgroup.events"))
+	}
+	c.events.Sync(paths)
+}
+
+// addCgroupSample adds the sample to the samples of the collection cycle.
+func addCgroupSample(samples map[string]cgroupSample, sample cgroupSample) {
+	// During a restart the old and the new container can briefly be running at the same time.
+	// Keep the newest one, since both would be exported with the same labels.
+	key := seriesKey(sample.labels)
+	if existing, found := samples[key]; !found || existing.createdAt < sample.createdAt {
+		samples[key] = sample
+	}
+}
+
+// collectCgroupMetrics reads the cgroup metrics of the container, and of its sub-cgroups if subcgroup_depth is set.
+func (c *Collector) collectCgroupMetrics(container Container) []cgroupSample {
+	cgroup, err := c.resolver.Resolve(container)
+	if err != nil {
+		slog.Warn("Failed to find cgroup", "container", container.Container, "error", err)
+		return nil
+	}
+
+	samples := []cgroupSample{
+		c.readCgroupSample(cgroup, container.ID, container.CreatedAt,
+			[]string{container.Namespace, container.Pod, container.Container, CgroupLevelContainer, "", ""}),
+	}
+
+	if c.config.SubcgroupDepth > 0 {
+		subcgroups, err := cgroup.Subcgroups(c.config.SubcgroupDepth)
+		if err != nil {
+			slog.Debug("Failed to list sub-cgroups", "container", container.Container, "error", err)
+		}
+		for _, subcgroup := range subcgroups {
+			sub := &CGroup{root: cgroup.root, path: filepath.Join(cgroup.path, subcgroup), hierarchy: cgroup.hierarchy}
+			samples = append(samples, c.readCgroupSample(sub, container.ID, container.CreatedAt,
+				[]string{container.Namespace, container.Pod, container.Container, CgroupLevelContainer, subcgroup, ""}))
+		}
+	}
+
+	slog.Debug("Collected cgroup metrics", "namespace", container.Namespace, "pod", container.Pod, "container", container.Container, "cgroups", len(samples))
+	return samples
+}
+
+// collectPodCgroupMetrics reads the cgroup metrics of the pods, and of the QoS class cgroups if enabled.
+// The pod cgroup is the parent of the cgroups of the containers of the pod sandbox, so it is found
+// from the cgroup of the newest container of the sandbox.
+func (c *Collector) collectPodCgroupMetrics(pods map[string]Container, samples map[string]cgroupSample) {
+	qosCgroups := make(map[string]*CGroup)
+
+	for sandboxID, container := range pods {
+		cgroup, err := c.resolver.Resolve(container)
+		if err != nil {
+			// Already logged when collecting the container metrics.
+			continue
+		}
+
+		pod := cgroup.parent()
+		if !isPodCgroup(filepath.Base(pod.path)) {
+			slog.Debug("Parent of container cgroup is not a pod cgroup", "namespace", container.Namespace, "pod", container.Pod, "path", pod.path)
+			continue
+		}
+
+		addCgroupSample(samples, c.readCgroupSample(pod, sandboxID, container.CreatedAt,
+			[]string{container.Namespace, container.Pod, "", CgroupLevelPod, "", ""}))
+
+		if !c.config.QoSCgroupMetrics {
+			continue
+		}
+
+		// Burstable and best-effort pods are in the cgroup of their QoS class, guaranteed pods are directly in kubepods.
+		for parent := pod.parent(); ; parent = parent.parent() {
+			level := qosCgroupLevel(filepath.Base(parent.path))
+			if level == "" {
+				break
+			}
+			qosCgroups[level] = parent
+			if level == QoSCgroupKubepods {
+				break
+			}
+		}
+	}
+
+	for level, cgroup := range qosCgroups {
+		addCgroupSample(samples, c.readCgroupSample(cgroup, cgroup.path, 0, []string{"", "", "", level, "", ""}))
+	}
+
+	slog.Debug("Collected pod cgroup metrics", "pods", len(pods), "qos_cgroups", len(qosCgroups))
+}
+
+// collectNodeCgroupMetrics reads the cgroup metrics of the node_cgroups, such as the root cgroup and system.slice.
+func (c *Collector) collectNodeCgroupMetrics(samples map[string]cgroupSample) {
+	for _, path := range c.config.NodeCgroups {
+		cgroup := c.resolver.newCgroup(filepath.Join("/", path))
+		if _, err := os.Stat(cgroup.dir("memory")); err != nil {
+			slog.Warn("Failed to find node cgroup", "path", path, "error", err)
+			continue
+		}
+
+		addCgroupSample(samples, c.readCgroupSample(cgroup, cgroup.path, 0, []string{"", "", "", CgroupLevelNode, "", path}))
+	}
+}
+
+// readCgroupSample reads all cgroup metrics of the cgroup.
+func (c *Collector) readCgroupSample(cgroup *CGroup, id string, createdAt int64, labels []string) cgroupSample {
+	sample := cgroupSample{
+		id:        id,
+		createdAt: createdAt,
+		labels:    labels,
+	}
+
+	for _, metric := range c.metrics {
 		value, err := c.readCgroupMetric(cgroup, metric)
 		if err != nil {
 			slog.Debug("Failed to read cgroup metric", "file", metric.cgroupFile, "field", metric.cgroupFileField, "error", err)
 			continue
 		}
 
-		if metric.gauge != nil {
-			metric.gauge.WithLabelValues(container.Namespace, container.Pod, container.Container).Set(float64(value))
-		} else if metric.counter != nil {
-			metric.counter.WithLabelValues(container.Namespace, container.Pod, container.Container).Add(float64(value))
+		sample.metrics = appendConstMetric(sample.metrics, metric.desc, metric.valueType, value, sample.labels...)
+	}
+
+	sample.metrics = append(sample.metrics, c.readHugetlbMetrics(cgroup, sample.labels)...)
+
+	sample.metrics = append(sample.metrics, c.readCpusetMetrics(cgroup, sample.labels)...)
+
+	if c.config.MemoryStatAllFields {
+		sample.metrics = append(sample.metrics, c.readMemoryStatMetrics(cgroup, sample.labels)...)
+	}
+
+	if cgroup.hierarchy == CgroupV2 {
+		sample.metrics = append(sample.metrics, c.readPressureMetrics(cgroup, sample.labels)...)
+		sample.metrics = append(sample.metrics, c.readIOStatMetrics(cgroup, sample.labels)...)
+		sample.metrics = append(sample.metrics, c.readNUMAStatMetrics(cgroup, sample.labels)...)
+	}
+
+	return sample
+}
+
+// appendConstMetric appends a const metric with the label values to metrics. Label values such as sub-cgroup
+// names are chosen by the workload, and values that are not valid UTF-8 are skipped instead of panicking.
+func appendConstMetric(metrics []prometheus.Metric, desc *prometheus.Desc, valueType prometheus.ValueType, value float64, labels ...string) []prometheus.Metric {
+	metric, err := prometheus.NewConstMetric(desc, valueType, value, labels...)
+	if err != nil {
+		slog.Debug("Failed to create metric", "desc", desc, "labels", labels, "error", err)
+		return metrics
+	}
+	return append(metrics, metric)
+}
+
+// validLabelValues checks that the label values are valid UTF-8, so that setting them on a metric vector
+// does not panic. The process name can be set to any bytes by the process.
+func validLabelValues(labels []string) bool {
+	for _, label := range labels {
+		if !utf8.ValidString(label) {
+			return false
+		}
+	}
+	return true
+}
+
+func (c *Collector) readCgroupMetric(cgroup *CGroup, metric Metric) (float64, error) {
+	file, field, index, scale := metric.cgroupFile, metric.cgroupFileField, metric.cgroupFileIndex, metric.scale
+	if cgroup.hierarchy != CgroupV2 {
+		file, field, index, scale = metric.cgroupV1File, metric.cgroupV1FileField, 0, metric.cgroupV1Scale
+	}
+	if scale == 0 {
+		scale = 1
+	}
+
+	var value int
+	if field == "" {
+		values, err := cgroup.ReadIntegerValues(file)
+		if err != nil {
+			return 0, err
+		}
+		if index >= len(values) {
+			return 0, fmt.Errorf("value %d not found in file %s", index, file)
+		}
+		value = values[index]
+	} else {
+		var err error
+		value, err = cgroup.ReadIntegerField(file, field)
+		if err != nil {
+			return 0, err
 		}
 	}
 
-	slog.Debug("Collected cgroup metrics", "namespace", container.Namespace, "pod", container.Pod, "container", container.Container)
+	// Keep -1 that indicates no limit.
+	if value < 0 {
+		return float64(value), nil
+	}
+	return float64(value) * scale, nil
 }
 
-func (c *Collector) readCgroupMetric(cgroup *CGroup, metric Metric) (int, error) {
-	if metric.cgroupFileField == "" {
-		return cgroup.ReadInteger(metric.cgroupFile)
+// readHugetlbMetrics reads the hugetlb controller files of the cgroup for each huge page size.
+func (c *Collector) readHugetlbMetrics(cgroup *CGroup, labels []string) []prometheus.Metric {
+	var metrics []prometheus.Metric
+	for _, size := range c.hugePageSizes {
+		sizeLabels := append(labels[:len(labels):len(labels)], size)
+		for _, metric := range cgroupHugetlbMetrics {
+			metric.cgroupFile = fmt.Sprintf(metric.cgroupFile, size)
+			metric.cgroupV1File = fmt.Sprintf(metric.cgroupV1File, size)
+
+			value, err := c.readCgroupMetric(cgroup, metric)
+			if err != nil {
+				slog.Debug("Failed to read cgroup metric", "file", metric.cgroupFile, "field", metric.cgroupFileField, "error", err)
+				continue
+			}
+			metrics = appendConstMetric(metrics, metric.desc, metric.valueType, value, sizeLabels...)
+		}
 	}
-	return cgroup.ReadIntegerField(metric.cgroupFile, metric.cgroupFileField)
+	return metrics
 }
 
-func (c *Collector) collectSmapsMetrics(container Container) {
-	if len(container.PIDs) == 0 {
-		slog.Debug("No PIDs to collect smaps for", "container", container.Container)
-		return
+// readNUMAStatMetrics reads the per-NUMA-node memory breakdown of the cgroup.
+func (c *Collector) readNUMAStatMetrics(cgroup *CGroup, labels []string) []prometheus.Metric {
+	stats, err := cgroup.ReadNUMAStat("memory.numa_stat")
+	if err != nil {
+		slog.Debug("Failed to read cgroup NUMA stat", "error", err)
+		return nil
 	}
 
-	for _, proc := range container.PIDs {
-		smapsPath := filepath.Join(c.config.Paths.Proc, strconv.Itoa(proc.PID), "smaps")
-		f, err := os.Open(smapsPath)
+	var metrics []prometheus.Metric
+	for memoryType, nodes := range stats {
+		for node, value := range nodes {
+			nodeLabels := append(labels[:len(labels):len(labels)], memoryType, node)
+			if isMemoryStatCounter(memoryType) {
+				metrics = appendConstMetric(metrics, cgroupMemoryNUMAStatTotal, prometheus.CounterValue, float64(value), nodeLabels...)
+			} else {
+				metrics = appendConstMetric(metrics, cgroupMemoryNUMAStatBytes, prometheus.GaugeValue, float64(value), nodeLabels...)
+			}
+		}
+	}
+	return metrics
+}
+
+// readCpusetMetrics reads the effective CPUs and memory nodes of the cgroup as info metrics.
+func (c *Collector) readCpusetMetrics(cgroup *CGroup, labels []string) []prometheus.Metric {
+	cpusFile, memsFile := "cpuset.cpus.effective", "cpuset.mems.effective"
+	if cgroup.hierarchy != CgroupV2 {
+		cpusFile, memsFile = "cpuset.effective_cpus", "cpuset.effective_mems"
+	}
+
+	var metrics []prometheus.Metric
+	for _, info := range []struct {
+		desc *prometheus.Desc
+		file string
+	}{
+		{cgroupCpusetCpusEffectiveInfo, cpusFile},
+		{cgroupCpusetMemsEffectiveInfo, memsFile},
+	} {
+		value, err := cgroup.ReadString(info.file)
 		if err != nil {
-			slog.Debug("Failed to open smaps", "pid", proc.PID, "error", err)
+			slog.Debug("Failed to read cgroup cpuset", "file", info.file, "error", err)
 			continue
 		}
+		infoLabels := append(labels[:len(labels):len(labels)], value)
+		metrics = appendConstMetric(metrics, info.desc, prometheus.GaugeValue, 1, infoLabels...)
+	}
+	return metrics
+}
+
+// readMemoryStatMetrics reads all fields of memory.stat of the cgroup.
+func (c *Collector) readMemoryStatMetrics(cgroup *CGroup, labels []string) []prometheus.Metric {
+	fields, err := cgroup.ReadKeyValues("memory.stat")
+	if err != nil {
+		slog.Debug("Failed to read cgroup memory stat", "error", err)
+		return nil
+	}
+
+	metrics := make([]prometheus.Metric, 0, len(fields))
+	for field, value := range fields {
+		fieldLabels := append(labels[:len(labels):len(labels)], field)
+		if isMemoryStatCounter(field) {
+			metrics = appendConstMetric(metrics, cgroupMemoryStatFieldTotal, prometheus.CounterValue, float64(value), fieldLabels...)
+		} else {
+			metrics = appendConstMetric(metrics, cgroupMemoryStatFieldBytes, prometheus.GaugeValue, float64(value), fieldLabels...)
+		}
+	}
+	return metrics
+}
 
-		mappings, err := ParseSmaps(f)
-		f.Close()
+// readPressureMetrics reads the Pressure Stall Information files of the cgroup.
+func (c *Collector) readPressureMetrics(cgroup *CGroup, labels []string) []prometheus.Metric {
+	var metrics []prometheus.Metric
+	for _, metric := range cgroupPressureMetrics {
+		pressure, err := cgroup.ReadPressure(metric.cgroupFile)
 		if err != nil {
-			slog.Warn("Failed to parse smaps", "pid", proc.PID, "error", err)
+			slog.Debug("Failed to read cgroup pressure", "file", metric.cgroupFile, "error", err)
 			continue
 		}
 
-		for _, m := range mappings {
-			c.setSmapsMetrics(container, proc, m)
+		for kind, stats := range pressure {
+			kindLabels := append(labels[:len(labels):len(labels)], kind)
+			metrics = appendConstMetric(metrics, metric.total, prometheus.CounterValue, float64(stats.Total), kindLabels...)
+			metrics = appendConstMetric(metrics, metric.avg10, prometheus.GaugeValue, stats.Avg10, kindLabels...)
+			metrics = appendConstMetric(metrics, metric.avg60, prometheus.GaugeValue, stats.Avg60, kindLabels...)
+			metrics = appendConstMetric(metrics, metric.avg300, prometheus.GaugeValue, stats.Avg300, kindLabels...)
+		}
+	}
+	return metrics
+}
+
+// readIOStatMetrics reads the per-device I/O statistics of the cgroup.
+func (c *Collector) readIOStatMetrics(cgroup *CGroup, labels []string) []prometheus.Metric {
+	stats, err := cgroup.ReadIOStat("io.stat")
+	if err != nil {
+		slog.Debug("Failed to read cgroup io stat", "error", err)
+		return nil
+	}
+
+	var metrics []prometheus.Metric
+	for device, fields := range stats {
+		deviceLabels := append(labels[:len(labels):len(labels)], c.devices.Name(device))
+		for _, metric := range cgroupIOStatMetrics {
+			if value, found := fields[metric.field]; found {
+				metrics = appendConstMetric(metrics, metric.desc, prometheus.CounterValue, float64(value), deviceLabels...)
+			}
+		}
+	}
+	return metrics
+}
+
+// processMetricLabels returns the values of processLabels for a process of the container.
+func processMetricLabels(container Container, proc ProcessInfo) []string {
+	return []string{container.Namespace, container.Pod, container.Container, strconv.Itoa(proc.PID), strconv.Itoa(proc.NSPID), proc.Comm}
+}
+
+// setProcessStatusMetrics exports the status of the processes of the container.
+func (c *Collector) setProcessStatusMetrics(container Container) {
+	for _, proc := range container.PIDs {
+		labels := processMetricLabels(container, proc)
+		c.processStatus.Set(labels, &proc.Status)
+		c.processStatusSeries.Observe(labels...)
+	}
+}
+
+// smapsModes returns whether full smaps and smaps_rollup are read in this collection cycle.
+// In hybrid mode the series of full smaps are kept between the collections that read it.
+func (c *Collector) smapsModes() (full, rollup bool) {
+	switch c.config.SmapsMode {
+	case SmapsModeRollup:
+		return false, true
+	case SmapsModeHybrid:
+		full = c.smapsCycles%c.config.SmapsFullEvery == 0
+		c.smapsCycles++
+		return full, true
+	}
+	return true, false
+}
+
+func (c *Collector) collectSmapsMetrics(container Container, full, rollup bool) {
+	if len(container.PIDs) == 0 {
+		slog.Debug("No PIDs to collect smaps for", "container", container.Container)
+		return
+	}
+
+	for _, proc := range container.PIDs {
+		if full {
+			c.collectProcessSmaps(container, proc)
 		}
+		if rollup {
+			c.collectProcessSmapsRollup(container, proc)
+		}
+	}
+}
+
+func (c *Collector) collectProcessSmaps(container Container, proc ProcessInfo) {
+	smapsPath := filepath.Join(c.config.Paths.Proc, strconv.Itoa(proc.PID), "smaps")
+	f, err := os.Open(smapsPath)
+	if err != nil {
+		slog.Debug("Failed to open smaps", "pid", proc.PID, "error", err)
+		return
+	}
+
+	mappings, err := ParseSmaps(f, c.config.SmapsAggregation, c.pathRules)
+	f.Close()
+	if err != nil {
+		slog.Warn("Failed to parse smaps", "pid", proc.PID, "error", err)
+		return
+	}
+
+	for _, m := range mappings {
+		c.setSmapsMetrics(container, proc, m)
+	}
+
+	slog.Debug("Collected smaps metrics", "namespace", container.Namespace, "pod", container.Pod, "container", container.Container, "pid", proc.PID, "ns_pid", proc.NSPID, "comm", proc.Comm, "mappings", len(mappings))
+}
 
-		slog.Debug("Collected smaps metrics", "namespace", container.Namespace, "pod", container.Pod, "container", container.Container, "pid", proc.PID, "ns_pid", proc.NSPID, "comm", proc.Comm, "mappings", len(mappings))
+func (c *Collector) collectProcessSmapsRollup(container Container, proc ProcessInfo) {
+	rollupPath := filepath.Join(c.config.Paths.Proc, strconv.Itoa(proc.PID), "smaps_rollup")
+	f, err := os.Open(rollupPath)
+	if err != nil {
+		slog.Debug("Failed to open smaps_rollup", "pid", proc.PID, "error", err)
+		return
 	}
+
+	m, err := ParseSmapsRollup(f)
+	f.Close()
+	if err != nil {
+		slog.Warn("Failed to parse smaps_rollup", "pid", proc.PID, "error", err)
+		return
+	}
+
+	labels := processMetricLabels(container, proc)
+	if !validLabelValues(labels) {
+		slog.Debug("Skipping smaps_rollup metrics with invalid label values", "pid", proc.PID, "labels", labels)
+		return
+	}
+	c.smapsRollupSeries.Observe(labels...)
+
+	c.smapsRollup.Rss.WithLabelValues(labels...).Set(float64(m.RssBytes))
+	c.smapsRollup.Pss.WithLabelValues(labels...).Set(float64(m.PssBytes))
+	c.smapsRollup.PssDirty.WithLabelValues(labels...).Set(float64(m.PssDirtyBytes))
+	c.smapsRollup.SharedClean.WithLabelValues(labels...).Set(float64(m.SharedCleanBytes))
+	c.smapsRollup.SharedDirty.WithLabelValues(labels...).Set(float64(m.SharedDirtyBytes))
+	c.smapsRollup.PrivateClean.WithLabelValues(labels...).Set(float64(m.PrivateCleanBytes))
+	c.smapsRollup.PrivateDirty.WithLabelValues(labels...).Set(float64(m.PrivateDirtyBytes))
+	c.smapsRollup.Referenced.WithLabelValues(labels...).Set(float64(m.ReferencedBytes))
+	c.smapsRollup.Anonymous.WithLabelValues(labels...).Set(float64(m.AnonymousBytes))
+	c.smapsRollup.LazyFree.WithLabelValues(labels...).Set(float64(m.LazyFreeBytes))
+	c.smapsRollup.AnonHugePages.WithLabelValues(labels...).Set(float64(m.AnonHugePagesBytes))
+	c.smapsRollup.ShmemPmdMapped.WithLabelValues(labels...).Set(float64(m.ShmemPmdMappedBytes))
+	c.smapsRollup.SharedHugetlb.WithLabelValues(labels...).Set(float64(m.SharedHugetlbBytes))
+	c.smapsRollup.PrivateHugetlb.WithLabelValues(labels...).Set(float64(m.PrivateHugetlbBytes))
+	c.smapsRollup.Swap.WithLabelValues(labels...).Set(float64(m.SwapBytes))
+	c.smapsRollup.SwapPss.WithLabelValues(labels...).Set(float64(m.SwapPssBytes))
+	c.smapsRollup.Locked.WithLabelValues(labels...).Set(float64(m.LockedBytes))
+
+	slog.Debug("Collected smaps_rollup metrics", "namespace", container.Namespace, "pod", container.Pod, "container", container.Container, "pid", proc.PID, "ns_pid", proc.NSPID, "comm", proc.Comm)
 }
 
 func (c *Collector) setSmapsMetrics(container Container, proc ProcessInfo, m *SmapsMapping) {
-	labels := []string{container.Namespace, container.Pod, container.Container, strconv.Itoa(proc.PID), strconv.Itoa(proc.NSPID), proc.Comm, m.Path}
-
-	ProcessSmapsSize.WithLabelValues(labels...).Set(float64(m.SizeBytes))
-	ProcessSmapsRss.WithLabelValues(labels...).Set(float64(m.RssBytes))
-	ProcessSmapsPss.WithLabelValues(labels...).Set(float64(m.PssBytes))
-	ProcessSmapsPssDirty.WithLabelValues(labels...).Set(float64(m.PssDirtyBytes))
-	ProcessSmapsSharedClean.WithLabelValues(labels...).Set(float64(m.SharedCleanBytes))
-	ProcessSmapsSharedDirty.WithLabelValues(labels...).Set(float64(m.SharedDirtyBytes))
-	ProcessSmapsPrivateClean.WithLabelValues(labels...).Set(float64(m.PrivateCleanBytes))
-	ProcessSmapsPrivateDirty.WithLabelValues(labels...).Set(float64(m.PrivateDirtyBytes))
-	ProcessSmapsReferenced.WithLabelValues(labels...).Set(float64(m.ReferencedBytes))
-	ProcessSmapsAnonymous.WithLabelValues(labels...).Set(float64(m.AnonymousBytes))
-	ProcessSmapsLazyFree.WithLabelValues(labels...).Set(float64(m.LazyFreeBytes))
-	ProcessSmapsAnonHugePages.WithLabelValues(labels...).Set(float64(m.AnonHugePagesBytes))
-	ProcessSmapsShmemPmdMapped.WithLabelValues(labels...).Set(float64(m.ShmemPmdMappedBytes))
-	ProcessSmapsSharedHugetlb.WithLabelValues(labels...).Set(float64(m.SharedHugetlbBytes))
-	ProcessSmapsPrivateHugetlb.WithLabelValues(labels...).Set(float64(m.PrivateHugetlbBytes))
-	ProcessSmapsSwap.WithLabelValues(labels...).Set(float64(m.SwapBytes))
-	ProcessSmapsSwapPss.WithLabelValues(labels...).Set(float64(m.SwapPssBytes))
-	ProcessSmapsKernelPageSize.WithLabelValues(labels...).Set(float64(m.KernelPageSizeBytes))
-	ProcessSmapsMMUPageSize.WithLabelValues(labels...).Set(float64(m.MMUPageSizeBytes))
-	ProcessSmapsLocked.WithLabelValues(labels...).Set(float64(m.LockedBytes))
+	labels := append(processMetricLabels(container, proc), m.aggregationKeys(c.config.SmapsAggregation)...)
+	if !validLabelValues(labels) {
+		slog.Debug("Skipping smaps metrics with invalid label values", "pid", proc.PID, "labels", labels)
+		return
+	}
+	c.smapsSeries.Observe(labels...)
+
+	c.smaps.Size.WithLabelValues(labels...).Set(float64(m.SizeBytes))
+	c.smaps.Rss.WithLabelValues(labels...).Set(float64(m.RssBytes))
+	c.smaps.Pss.WithLabelValues(labels...).Set(float64(m.PssBytes))
+	c.smaps.PssDirty.WithLabelValues(labels...).Set(float64(m.PssDirtyBytes))
+	c.smaps.SharedClean.WithLabelValues(labels...).Set(float64(m.SharedCleanBytes))
+	c.smaps.SharedDirty.WithLabelValues(labels...).Set(float64(m.SharedDirtyBytes))
+	c.smaps.PrivateClean.WithLabelValues(labels...).Set(float64(m.PrivateCleanBytes))
+	c.smaps.PrivateDirty.WithLabelValues(labels...).Set(float64(m.PrivateDirtyBytes))
+	c.smaps.Referenced.WithLabelValues(labels...).Set(float64(m.ReferencedBytes))
+	c.smaps.Anonymous.WithLabelValues(labels...).Set(float64(m.AnonymousBytes))
+	c.smaps.LazyFree.WithLabelValues(labels...).Set(float64(m.LazyFreeBytes))
+	c.smaps.AnonHugePages.WithLabelValues(labels...).Set(float64(m.AnonHugePagesBytes))
+	c.smaps.ShmemPmdMapped.WithLabelValues(labels...).Set(float64(m.ShmemPmdMappedBytes))
+	c.smaps.SharedHugetlb.WithLabelValues(labels...).Set(float64(m.SharedHugetlbBytes))
+	c.smaps.PrivateHugetlb.WithLabelValues(labels...).Set(float64(m.PrivateHugetlbBytes))
+	c.smaps.Swap.WithLabelValues(labels...).Set(float64(m.SwapBytes))
+	c.smaps.SwapPss.WithLabelValues(labels...).Set(float64(m.SwapPssBytes))
+	c.smaps.KernelPageSize.WithLabelValues(labels...).Set(float64(m.KernelPageSizeBytes))
+	c.smaps.MMUPageSize.WithLabelValues(labels...).Set(float64(m.MMUPageSizeBytes))
+	c.smaps.Locked.WithLabelValues(labels...).Set(float64(m.LockedBytes))
+}
+
+// CgroupCollector exports the latest cgroup values read for each container as const metrics.
+//
+// The kernel maintains cumulative statistics such as cpu.stat:usage_usec per cgroup, so the values
+// are exported as-is instead of being accumulated by the exporter. A restarted container gets a new
+// container ID and a new cgroup whose statistics start from zero, which Prometheus handles as a
+// regular counter reset.
+//
+// Samples of containers that have disappeared are removed by SeriesTracker via DeleteLabelValues.
+type CgroupCollector struct {
+	mu      sync.Mutex
+	metrics []Metric
+	samples map[string]cgroupSample
+}
+
+// cgroupSample holds the metrics read from a single cgroup of a container, pod or QoS class.
+type cgroupSample struct {
+	// id is the ID of the container or pod sandbox, or the path of the QoS class cgroup.
+	id        string
+	createdAt int64
+	labels    []string
+	metrics   []prometheus.Metric
+}
+
+func NewCgroupCollector(metrics []Metric) *CgroupCollector {
+	return &CgroupCollector{
+		metrics: metrics,
+		samples: make(map[string]cgroupSample),
+	}
+}
+
+// Set replaces the exported sample for the container identified by the sample labels.
+func (c *CgroupCollector) Set(sample cgroupSample) {
+	key := seriesKey(sample.labels)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if previous, found := c.samples[key]; found && previous.id != sample.id {
+		slog.Info("Container or pod restarted, cgroup counters start from zero", "labels", sample.labels, "previous_id", previous.id, "id", sample.id)
+	}
+
+	c.samples[key] = sample
+}
+
+// DeleteLabelValues removes the sample with the given label values.
+func (c *CgroupCollector) DeleteLabelValues(lvs ...string) bool {
+	key := seriesKey(lvs)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, found := c.samples[key]; !found {
+		return false
+	}
+	delete(c.samples, key)
+	return true
+}
+
+// Describe implements prometheus.Collector.
+func (c *CgroupCollector) Describe(ch chan<- *prometheus.Desc) {
+	for _, metric := range c.metrics {
+		ch <- metric.desc
+	}
+	for _, metric := range cgroupHugetlbMetrics {
+		ch <- metric.desc
+	}
+	ch <- cgroupMemoryNUMAStatBytes
+	ch <- cgroupMemoryNUMAStatTotal
+	ch <- cgroupCpusetCpusEffectiveInfo
+	ch <- cgroupCpusetMemsEffectiveInfo
+	ch <- cgroupMemoryStatFieldBytes
+	ch <- cgroupMemoryStatFieldTotal
+	for _, metric := range cgroupPressureMetrics {
+		ch <- metric.total
+		ch <- metric.avg10
+		ch <- metric.avg60
+		ch <- metric.avg300
+	}
+	for _, metric := range cgroupIOStatMetrics {
+		ch <- metric.desc
+	}
+}
+
+// Collect implements prometheus.Collector.
+func (c *CgroupCollector) Collect(ch chan<- prometheus.Metric) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, sample := range c.samples {
+		for _, m := range sample.metrics {
+			ch <- m
+		}
+	}
+}
+
+// ProcessStatusCollector exports the latest /proc/<pid>/status values of each process as const metrics,
+// so that the context switch counts maintained by the kernel can be exported as counters.
+//
+// Metrics of processes that have exited are removed by SeriesTracker via DeleteLabelValues.
+type ProcessStatusCollector struct {
+	mu      sync.Mutex
+	samples map[string][]prometheus.Metric
+}
+
+func NewProcessStatusCollector() *ProcessStatusCollector {
+	return &ProcessStatusCollector{
+		samples: make(map[string][]prometheus.Metric),
+	}
+}
+
+// Set replaces the metrics of the process with the given label values.
+func (c *ProcessStatusCollector) Set(labels []string, status *ProcessStatus) {
+	metrics := make([]prometheus.Metric, 0, len(processStatusMetrics))
+	for _, metric := range processStatusMetrics {
+		metrics = appendConstMetric(metrics, metric.desc, metric.valueType, float64(metric.value(status)), labels...)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.samples[seriesKey(labels)] = metrics
+}
+
+// DeleteLabelValues removes the metrics of the process with the given label values.
+func (c *ProcessStatusCollector) DeleteLabelValues(lvs ...string) bool {
+	key := seriesKey(lvs)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, found := c.samples[key]; !found {
+		return false
+	}
+	delete(c.samples, key)
+	return true
+}
+
+// Describe implements prometheus.Collector.
+func (c *ProcessStatusCollector) Describe(ch chan<- *prometheus.Desc) {
+	for _, metric := range processStatusMetrics {
+		ch <- metric.desc
+	}
+}
+
+// Collect implements prometheus.Collector.
+func (c *ProcessStatusCollector) Collect(ch chan<- prometheus.Metric) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, metrics := range c.samples {
+		for _, m := range metrics {
+			ch <- m
+		}
+	}
 }
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestAppendConstMetricInvalidLabel(t *testing.T) {
+	desc := prometheus.NewDesc("test_metric", "Test metric.", []string{"subcgroup"}, nil)
+
+	metrics := appendConstMetric(nil, desc, prometheus.GaugeValue, 1, "init.scope")
+	metrics = appendConstMetric(metrics, desc, prometheus.GaugeValue, 1, "\xff")
+	if len(metrics) != 1 {
+		t.Errorf("got %d metrics, want 1", len(metrics))
+	}
+}
+
+func TestProcessStatusCollectorInvalidComm(t *testing.T) {
+	c := NewProcessStatusCollector()
+	c.Set([]string{"default", "pod", "app", "100", "1", "\xff"}, &ProcessStatus{Threads: 1})
+
+	ch := make(chan prometheus.Metric, len(processStatusMetrics))
+	c.Collect(ch)
+	if len(ch) != 0 {
+		t.Errorf("got %d metrics, want 0", len(ch))
+	}
+}
@@ -5,17 +5,53 @@ import (
 	"log/slog"
 	"os"
 	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
 	"time"
 
 	"gopkg.in/yaml.v3"
 )
 
+// Collection modes.
+const (
+	// CollectionModeInterval collects metrics periodically every scrape_interval.
+	CollectionModeInterval = "interval"
+	// CollectionModeOnScrape collects metrics when Prometheus scrapes the exporter.
+	CollectionModeOnScrape = "on_scrape"
+)
+
+// Smaps modes.
+const (
+	// SmapsModeFull reads /proc/<pid>/smaps and exports metrics per mapping.
+	SmapsModeFull = "full"
+	// SmapsModeRollup reads /proc/<pid>/smaps_rollup and exports totals per process.
+	SmapsModeRollup = "rollup"
+	// SmapsModeHybrid reads smaps_rollup on every collection and full smaps every smaps_full_every collections.
+	SmapsModeHybrid = "hybrid"
+)
+
 type Config struct {
-	Server         ServerConfig      `yaml:"server"`
-	Paths          PathsConfig       `yaml:"paths"`
-	ScrapeInterval string            `yaml:"scrape_interval"`
-	LogLevel       string            `yaml:"log_level"`
-	Filters        []ContainerFilter `yaml:"filters"`
+	Server                  ServerConfig         `yaml:"server"`
+	Paths                   PathsConfig          `yaml:"paths"`
+	CollectionMode          string               `yaml:"collection_mode"`
+	ScrapeInterval          string               `yaml:"scrape_interval"`
+	DiscoveryResyncInterval string               `yaml:"discovery_resync_interval"`
+	MinCollectionAge        string               `yaml:"min_collection_age"`
+	StaleSeriesGracePeriod  string               `yaml:"stale_series_grace_period"`
+	CgroupEventsMinInterval string               `yaml:"cgroup_events_min_interval"`
+	LogLevel                string               `yaml:"log_level"`
+	Filters                 []ContainerFilter    `yaml:"filters"`
+	CgroupMetrics           []CgroupMetricConfig `yaml:"cgroup_metrics"`
+	ExtraCgroupMetrics      []CgroupMetricConfig `yaml:"extra_cgroup_metrics"`
+	MemoryStatAllFields     bool                 `yaml:"memory_stat_all_fields"`
+	QoSCgroupMetrics        bool                 `yaml:"qos_cgroup_metrics"`
+	SubcgroupDepth          int                  `yaml:"subcgroup_depth"`
+	NodeCgroups             []string             `yaml:"node_cgroups"`
+	SmapsMode               string               `yaml:"smaps_mode"`
+	SmapsFullEvery          int                  `yaml:"smaps_full_every"`
+	SmapsAggregation        string               `yaml:"smaps_aggregation"`
+	PathRules               []PathRuleConfig     `yaml:"path_rules"`
 }
 
 type ServerConfig struct {
@@ -25,6 +61,7 @@ type ServerConfig struct {
 type PathsConfig struct {
 	Cgroup    string `yaml:"cgroup"`
 	Proc      string `yaml:"proc"`
+	Sys       string `yaml:"sys"`
 	CRISocket string `yaml:"cri_socket"`
 }
 
@@ -35,6 +72,60 @@ type ContainerFilter struct {
 	Command   string `yaml:"command"`
 }
 
+// Metric types.
+const (
+	MetricTypeGauge   = "gauge"
+	MetricTypeCounter = "counter"
+)
+
+// CgroupMetricConfig declares a metric read from a cgroup file.
+type CgroupMetricConfig struct {
+	// Name of the metric.
+	Name string `yaml:"name"`
+	// Help text of the metric. Defaults to a description of the source file.
+	Help string `yaml:"help"`
+	// Type of the metric, gauge or counter.
+	Type string `yaml:"type"`
+	// File is the cgroup v2 interface file, e.g. memory.stat.
+	File string `yaml:"file"`
+	// Field is the key in files with key-value pairs, e.g. anon in memory.stat.
+	Field string `yaml:"field"`
+	// Index selects the value by position in files with several values on a single line, e.g. 1 for the period in cpu.max.
+	Index int `yaml:"index"`
+	// Scale multiplies the value, e.g. 0.000001 to convert microseconds to seconds. Defaults to 1.
+	Scale float64 `yaml:"scale"`
+	// V1File, V1Field and V1Scale declare the equivalent value on cgroup v1.
+	// Metrics without V1File are not available on cgroup v1.
+	V1File  string  `yaml:"v1_file"`
+	V1Field string  `yaml:"v1_field"`
+	V1Scale float64 `yaml:"v1_scale"`
+}
+
+var metricNameRe = regexp.MustCompile(`^[a-zA-Z_:][a-zA-Z0-9_:]*$`)
+
+// PathRuleConfig declares a rewrite of the path of smaps mappings, either by a built-in preset or
+// by a regular expression and its replacement.
+type PathRuleConfig struct {
+	// Preset is the name of a built-in rule in pathRulePresets.
+	Preset string `yaml:"preset"`
+	// Regex is matched against the path of the mapping.
+	Regex string `yaml:"regex"`
+	// Replacement replaces the matches of Regex, and can refer to submatches as $1 or ${name}.
+	Replacement string `yaml:"replacement"`
+}
+
+// pathRulePresets are the built-in path rules that can be referred to by name in path_rules.
+var pathRulePresets = map[string]PathRuleConfig{
+	// Files that have been deleted while mapped, e.g. replaced libraries.
+	"strip_deleted": {Regex: `^(.*) \(deleted\)$`, Replacement: "$1"},
+	// Files under /proc of the process itself or of other processes.
+	"collapse_proc_self": {Regex: `^/proc/(?:self|thread-self|\d+)/.*$`, Replacement: "/proc/self/*"},
+	// POSIX shared memory objects.
+	"group_dev_shm": {Regex: `^/dev/shm/.*$`, Replacement: "/dev/shm/*"},
+	// Anonymous files created with memfd_create, named by the application.
+	"group_memfd": {Regex: `^/memfd:.*$`, Replacement: "/memfd:*"},
+}
+
 func LoadConfig(path string) (*Config, error) {
 	data, err := os.ReadFile(path)
 	if err != nil {
@@ -69,19 +160,59 @@ func (c *Config) applyDefaults() {
 		c.Paths.Proc = "/proc"
 	}
 
+	if c.Paths.Sys == "" {
+		c.Paths.Sys = "/sys"
+	}
+
 	if c.Paths.CRISocket == "" {
 		// Auto-detect CRI socket from common locations
 		c.Paths.CRISocket = detectCRISocket()
 	}
 
+	if c.CollectionMode == "" {
+		c.CollectionMode = CollectionModeInterval
+	}
+
 	if c.ScrapeInterval == "" {
 		c.ScrapeInterval = "1s"
 	}
 
+	if c.DiscoveryResyncInterval == "" {
+		c.DiscoveryResyncInterval = "30s"
+	}
+
+	if c.MinCollectionAge == "" {
+		c.MinCollectionAge = "1s"
+	}
+
+	if c.StaleSeriesGracePeriod == "" {
+		c.StaleSeriesGracePeriod = "0s"
+	}
+
+	if c.CgroupEventsMinInterval == "" {
+		c.CgroupEventsMinInterval = "1s"
+	}
+
 	if c.LogLevel == "" {
 		c.LogLevel = "info"
 	}
 
+	if c.SmapsMode == "" {
+		c.SmapsMode = SmapsModeFull
+	}
+
+	if c.SmapsFullEvery == 0 {
+		c.SmapsFullEvery = 10
+	}
+
+	if c.SmapsAggregation == "" {
+		c.SmapsAggregation = SmapsAggregationPath
+	}
+
+	if len(c.CgroupMetrics) == 0 {
+		c.CgroupMetrics = defaultCgroupMetrics
+	}
+
 	// Add default wildcard command filter to each container filter if not specified.
 	for i := range c.Filters {
 		if c.Filters[i].Command == "" {
@@ -107,14 +238,93 @@ func (c *Config) Validate() error {
 		return fmt.Errorf("paths.cri_socket was not auto-detected and is required to be specified")
 	}
 
+	if c.CollectionMode != CollectionModeInterval && c.CollectionMode != CollectionModeOnScrape {
+		return fmt.Errorf("invalid collection_mode %q: must be %q or %q", c.CollectionMode, CollectionModeInterval, CollectionModeOnScrape)
+	}
+
 	if _, err := time.ParseDuration(c.ScrapeInterval); err != nil {
 		return fmt.Errorf("invalid scrape_interval: %w", err)
 	}
 
+	if d, err := time.ParseDuration(c.DiscoveryResyncInterval); err != nil {
+		return fmt.Errorf("invalid discovery_resync_interval: %w", err)
+	} else if d <= 0 {
+		return fmt.Errorf("discovery_resync_interval must be positive")
+	}
+
+	if _, err := time.ParseDuration(c.MinCollectionAge); err != nil {
+		return fmt.Errorf("invalid min_collection_age: %w", err)
+	}
+
+	if d, err := time.ParseDuration(c.StaleSeriesGracePeriod); err != nil {
+		return fmt.Errorf("invalid stale_series_grace_period: %w", err)
+	} else if d < 0 {
+		return fmt.Errorf("stale_series_grace_period must not be negative")
+	}
+
+	if d, err := time.ParseDuration(c.CgroupEventsMinInterval); err != nil {
+		return fmt.Errorf("invalid cgroup_events_min_interval: %w", err)
+	} else if d < 0 {
+		return fmt.Errorf("cgroup_events_min_interval must not be negative")
+	}
+
+	if c.SmapsMode != SmapsModeFull && c.SmapsMode != SmapsModeRollup && c.SmapsMode != SmapsModeHybrid {
+		return fmt.Errorf("invalid smaps_mode %q: must be %q, %q or %q", c.SmapsMode, SmapsModeFull, SmapsModeRollup, SmapsModeHybrid)
+	}
+
+	if c.SmapsFullEvery < 1 {
+		return fmt.Errorf("smaps_full_every must be positive")
+	}
+
+	switch c.SmapsAggregation {
+	case SmapsAggregationPath, SmapsAggregationPermsPath, SmapsAggregationCategory, SmapsAggregationNone:
+	default:
+		return fmt.Errorf("invalid smaps_aggregation %q: must be %q, %q, %q or %q", c.SmapsAggregation,
+			SmapsAggregationPath, SmapsAggregationPermsPath, SmapsAggregationCategory, SmapsAggregationNone)
+	}
+
+	if c.SubcgroupDepth < 0 {
+		return fmt.Errorf("subcgroup_depth must not be negative")
+	}
+
+	for i, path := range c.NodeCgroups {
+		if path == "" || strings.Contains(path, "..") {
+			return fmt.Errorf("invalid node_cgroups[%d] %q: must be a path within paths.cgroup", i, path)
+		}
+	}
+
 	if len(c.Filters) == 0 {
 		return fmt.Errorf("at least one container filter is required")
 	}
 
+	names := make(map[string]bool)
+	for _, list := range []struct {
+		option  string
+		metrics []CgroupMetricConfig
+	}{
+		{"cgroup_metrics", c.CgroupMetrics},
+		{"extra_cgroup_metrics", c.ExtraCgroupMetrics},
+	} {
+		for i, m := range list.metrics {
+			if err := m.Validate(); err != nil {
+				return fmt.Errorf("invalid %s[%d]: %w", list.option, i, err)
+			}
+			if names[m.Name] {
+				return fmt.Errorf("invalid %s[%d]: duplicate metric name %q", list.option, i, m.Name)
+			}
+			names[m.Name] = true
+			if isBuiltinMetricName(m.Name) {
+				return fmt.Errorf("invalid %s[%d]: metric name %q is used by a built-in metric", list.option, i, m.Name)
+			}
+		}
+	}
+
+	for i, r := range c.PathRules {
+		if err := r.Validate(); err != nil {
+			return fmt.Errorf("invalid path_rules[%d]: %w", i, err)
+		}
+	}
+
 	// Validate that paths exist.
 	for _, path := range []struct {
 		name string
@@ -135,12 +345,107 @@ func (c *Config) Validate() error {
 	return nil
 }
 
+func (r *PathRuleConfig) Validate() error {
+	if r.Preset != "" {
+		if r.Regex != "" || r.Replacement != "" {
+			return fmt.Errorf("preset and regex are mutually exclusive")
+		}
+		if _, found := pathRulePresets[r.Preset]; !found {
+			return fmt.Errorf("unknown preset %q", r.Preset)
+		}
+		return nil
+	}
+
+	if r.Regex == "" {
+		return fmt.Errorf("preset or regex is required")
+	}
+	if _, err := regexp.Compile(r.Regex); err != nil {
+		return fmt.Errorf("invalid regex %q: %w", r.Regex, err)
+	}
+	return nil
+}
+
+// GetPathRules compiles and returns the path rules, with the presets resolved.
+func (c *Config) GetPathRules() []PathRule {
+	rules := make([]PathRule, 0, len(c.PathRules))
+	for _, r := range c.PathRules {
+		if r.Preset != "" {
+			r = pathRulePresets[r.Preset]
+		}
+		rules = append(rules, PathRule{Regex: regexp.MustCompile(r.Regex), Replacement: r.Replacement})
+	}
+	return rules
+}
+
+func (m *CgroupMetricConfig) Validate() error {
+	if !metricNameRe.MatchString(m.Name) {
+		return fmt.Errorf("invalid metric name %q", m.Name)
+	}
+
+	if m.Type != MetricTypeGauge && m.Type != MetricTypeCounter {
+		return fmt.Errorf("invalid type %q for metric %s: must be %q or %q", m.Type, m.Name, MetricTypeGauge, MetricTypeCounter)
+	}
+
+	for _, file := range []string{m.File, m.V1File} {
+		if strings.ContainsAny(file, "/\\") || file == "." || file == ".." {
+			return fmt.Errorf("invalid file %q for metric %s: must be a file name within the cgroup directory", file, m.Name)
+		}
+	}
+
+	if m.File == "" {
+		return fmt.Errorf("file is required for metric %s", m.Name)
+	}
+
+	if m.Index < 0 {
+		return fmt.Errorf("invalid index %d for metric %s: must not be negative", m.Index, m.Name)
+	}
+
+	if m.Field != "" && m.Index != 0 {
+		return fmt.Errorf("field and index are mutually exclusive for metric %s", m.Name)
+	}
+
+	if m.V1File == "" && (m.V1Field != "" || m.V1Scale != 0) {
+		return fmt.Errorf("v1_field and v1_scale require v1_file for metric %s", m.Name)
+	}
+
+	return nil
+}
+
 // GetScrapeInterval parses and returns the scrape interval as time.Duration.
 func (c *Config) GetScrapeInterval() time.Duration {
 	d, _ := time.ParseDuration(c.ScrapeInterval)
 	return d
 }
 
+// GetDiscoveryResyncInterval parses and returns the discovery resync interval as time.Duration.
+func (c *Config) GetDiscoveryResyncInterval() time.Duration {
+	d, _ := time.ParseDuration(c.DiscoveryResyncInterval)
+	return d
+}
+
+// GetMinCollectionAge parses and returns the minimum collection age as time.Duration.
+func (c *Config) GetMinCollectionAge() time.Duration {
+	d, _ := time.ParseDuration(c.MinCollectionAge)
+	return d
+}
+
+// GetStaleSeriesGracePeriod parses and returns the stale series grace period as time.Duration.
+func (c *Config) GetStaleSeriesGracePeriod() time.Duration {
+	d, _ := time.ParseDuration(c.StaleSeriesGracePeriod)
+	return d
+}
+
+// GetCgroupMetrics returns the cgroup_metrics, or the built-in metrics if not specified, followed by the extra_cgroup_metrics.
+func (c *Config) GetCgroupMetrics() []CgroupMetricConfig {
+	return slices.Concat(c.CgroupMetrics, c.ExtraCgroupMetrics)
+}
+
+// GetCgroupEventsMinInterval parses and returns the minimum interval of cgroup event collections as time.Duration.
+func (c *Config) GetCgroupEventsMinInterval() time.Duration {
+	d, _ := time.ParseDuration(c.CgroupEventsMinInterval)
+	return d
+}
+
 // MatchesContainer checks if a container matches any of the configured filters.
 func (c *Config) MatchesContainer(namespace, pod, container string) bool {
 	for _, filter := range c.Filters {
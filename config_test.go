@@ -0,0 +1,65 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// newTestConfig returns a valid configuration with the defaults applied.
+func newTestConfig(t *testing.T) *Config {
+	t.Helper()
+	dir := t.TempDir()
+	config := &Config{
+		Paths:   PathsConfig{Cgroup: dir, Proc: dir, CRISocket: dir},
+		Filters: []ContainerFilter{{Namespace: "*", Pod: "*", Container: "*", Command: "*"}},
+	}
+	config.applyDefaults()
+	return config
+}
+
+func TestExtraCgroupMetrics(t *testing.T) {
+	config := newTestConfig(t)
+	config.ExtraCgroupMetrics = []CgroupMetricConfig{
+		{Name: "cgroup_memory_stat_sock_bytes", Type: MetricTypeGauge, File: "memory.stat", Field: "sock"},
+	}
+	if err := config.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(config.GetCgroupMetrics()), len(defaultCgroupMetrics)+1; got != want {
+		t.Errorf("got %d cgroup metrics, want %d", got, want)
+	}
+
+	config.ExtraCgroupMetrics = append(config.ExtraCgroupMetrics, defaultCgroupMetrics[0])
+	if err := config.Validate(); err == nil || !strings.Contains(err.Error(), "duplicate metric name") {
+		t.Errorf("Validate() error = %v, want duplicate metric name", err)
+	}
+}
+
+func TestValidateCgroupMetricNames(t *testing.T) {
+	tests := []struct {
+		name    string
+		wantErr bool
+	}{
+		{name: "cgroup_custom_value", wantErr: false},
+		{name: "cgroup_io_read_bytes_total", wantErr: true},
+		{name: "cgroup_hugetlb_current_bytes", wantErr: true},
+		{name: "cgroup_cpu_pressure_stalled_usec_total", wantErr: true},
+		{name: "process_status_threads", wantErr: true},
+		{name: "process_smaps_rss_bytes", wantErr: true},
+		{name: "go_goroutines", wantErr: true},
+		{name: "process_resident_memory_bytes", wantErr: true},
+		{name: "promhttp_metric_handler_requests_total", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := newTestConfig(t)
+			config.ExtraCgroupMetrics = []CgroupMetricConfig{{Name: tt.name, Type: MetricTypeGauge, File: "memory.custom"}}
+
+			err := config.Validate()
+			if gotErr := err != nil && strings.Contains(err.Error(), "used by a built-in metric"); gotErr != tt.wantErr || err != nil && !gotErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
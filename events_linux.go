@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"os"
+	"sync"
+	"syscall"
+	"unsafe"
+)
+
+// CgroupEventWatcher watches cgroup.events files with inotify and signals when any of them changes,
+// e.g. when a cgroup becomes unpopulated or is frozen.
+type CgroupEventWatcher struct {
+	// fd is used for adding and removing watches, since File.Fd would set the file to blocking mode.
+	fd   int
+	file *os.File
+
+	mu      sync.Mutex
+	watches map[string]int
+
+	changed chan struct{}
+}
+
+func NewCgroupEventWatcher() (*CgroupEventWatcher, error) {
+	// The inotify file descriptor is non-blocking, so that reads use the runtime poller and
+	// are interrupted when the file is closed.
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return nil, os.NewSyscallError("inotify_init1", err)
+	}
+
+	return &CgroupEventWatcher{
+		fd:      fd,
+		file:    os.NewFile(uintptr(fd), "inotify"),
+		watches: make(map[string]int),
+		changed: make(chan struct{}, 1),
+	}, nil
+}
+
+// Changed returns a channel that receives a value when a watched file has changed.
+// Changes that happen before the previous one has been received are coalesced.
+func (w *CgroupEventWatcher) Changed() <-chan struct{} {
+	return w.changed
+}
+
+// Start reads inotify events in the background until the context is cancelled.
+func (w *CgroupEventWatcher) Start(ctx context.Context) {
+	go func() {
+		<-ctx.Done()
+		w.file.Close()
+	}()
+	go w.readEvents()
+}
+
+func (w *CgroupEventWatcher) readEvents() {
+	buf := make([]byte, 4096)
+	for {
+		n, err := w.file.Read(buf)
+		if err != nil {
+			if !errors.Is(err, os.ErrClosed) {
+				slog.Warn("Failed to read cgroup events", "error", err)
+			}
+			return
+		}
+
+		modified := false
+		for offset := 0; offset+syscall.SizeofInotifyEvent <= n; {
+			event := (*syscall.InotifyEvent)(unsafe.Pointer(&buf[offset]))
+			if event.Mask&syscall.IN_MODIFY != 0 {
+				modified = true
+			}
+			offset += syscall.SizeofInotifyEvent + int(event.Len)
+		}
+
+		if modified {
+			select {
+			case w.changed <- struct{}{}:
+			default:
+			}
+		}
+	}
+}
+
+// Sync watches the given files and stops watching the files that are no longer in the list.
+func (w *CgroupEventWatcher) Sync(paths []string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	live := make(map[string]bool, len(paths))
+	for _, path := range paths {
+		live[path] = true
+		if _, found := w.watches[path]; found {
+			continue
+		}
+
+		wd, err := syscall.InotifyAddWatch(w.fd, path, syscall.IN_MODIFY)
+		if err != nil {
+			slog.Debug("Failed to watch cgroup events", "path", path, "error", err)
+			continue
+		}
+		w.watches[path] = wd
+	}
+
+	for path, wd := range w.watches {
+		if !live[path] {
+			// The watch is already gone if the cgroup was removed.
+			_, _ = syscall.InotifyRmWatch(w.fd, uint32(wd))
+			delete(w.watches, path)
+		}
+	}
+}
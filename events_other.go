@@ -0,0 +1,21 @@
+//go:build !linux
+
+package main
+
+import (
+	"context"
+	"errors"
+)
+
+// CgroupEventWatcher is not supported on other platforms than Linux.
+type CgroupEventWatcher struct{}
+
+func NewCgroupEventWatcher() (*CgroupEventWatcher, error) {
+	return nil, errors.New("watching cgroup events is supported only on Linux")
+}
+
+func (w *CgroupEventWatcher) Changed() <-chan struct{} { return nil }
+
+func (w *CgroupEventWatcher) Start(ctx context.Context) {}
+
+func (w *CgroupEventWatcher) Sync(paths []string) {}
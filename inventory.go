@@ -0,0 +1,275 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	runtimeapi "k8s.io/cri-api/pkg/apis/runtime/v1"
+)
+
+// eventStreamRetryDelay is the delay before reconnecting a broken container event stream.
+const eventStreamRetryDelay = 5 * time.Second
+
+// ContainerInventory keeps an in-memory list of the running containers that match the configured filters.
+//
+// The inventory is populated by listing pods and containers over CRI and kept current by the
+// GetContainerEvents streaming RPC. A periodic full resync corrects any missed events and keeps the
+// inventory current on runtimes that do not support container events. Events and resyncs are applied
+// on one goroutine, so that a resync does not undo the events received while it lists the containers.
+// Reading the inventory never talks to the container runtime.
+type ContainerInventory struct {
+	criClient runtimeapi.RuntimeServiceClient
+	config    *Config
+
+	mu         sync.RWMutex
+	containers map[string]Container
+	synced     bool
+
+	resyncCh chan struct{}
+	events   chan *runtimeapi.ContainerEventResponse
+}
+
+func NewContainerInventory(criClient runtimeapi.RuntimeServiceClient, config *Config) *ContainerInventory {
+	return &ContainerInventory{
+		criClient:  criClient,
+		config:     config,
+		containers: make(map[string]Container),
+		resyncCh:   make(chan struct{}, 1),
+		events:     make(chan *runtimeapi.ContainerEventResponse),
+	}
+}
+
+// Start populates the inventory and keeps it current in the background until the context is cancelled.
+func (inv *ContainerInventory) Start(ctx context.Context) {
+	// Open the event stream before listing the containers, so that containers started during the listing
+	// are not missed. The events are buffered by the stream until they are applied after the listing.
+	stream, err := inv.criClient.GetContainerEvents(ctx, &runtimeapi.GetEventsRequest{})
+
+	if err := inv.resync(ctx); err != nil {
+		slog.Error("Failed to populate container inventory", "error", err)
+	}
+
+	go inv.watchEvents(ctx, stream, err)
+	go inv.run(ctx)
+}
+
+// Containers returns a snapshot of the containers in the inventory.
+func (inv *ContainerInventory) Containers() ([]Container, error) {
+	inv.mu.RLock()
+	defer inv.mu.RUnlock()
+
+	if !inv.synced {
+		return nil, fmt.Errorf("container inventory has not been populated yet")
+	}
+
+	containers := make([]Container, 0, len(inv.containers))
+	for _, c := range inv.containers {
+		containers = append(containers, c)
+	}
+	return containers, nil
+}
+
+// run applies the received container events and resyncs the inventory periodically and on request.
+func (inv *ContainerInventory) run(ctx context.Context) {
+	ticker := time.NewTicker(inv.config.GetDiscoveryResyncInterval())
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event := <-inv.events:
+			inv.handleEvent(ctx, event)
+			continue
+		case <-ticker.C:
+		case <-inv.resyncCh:
+		}
+
+		if err := inv.resync(ctx); err != nil {
+			slog.Warn("Failed to resync container inventory", "error", err)
+		}
+	}
+}
+
+// requestResync schedules a full resync, e.g. after an event that could not be applied.
+func (inv *ContainerInventory) requestResync() {
+	select {
+	case inv.resyncCh <- struct{}{}:
+	default:
+	}
+}
+
+// resync replaces the inventory with the running containers listed from the container runtime.
+func (inv *ContainerInventory) resync(ctx context.Context) error {
+	slog.Debug("Resyncing container inventory")
+
+	podResp, err := inv.criClient.ListPodSandbox(ctx, &runtimeapi.ListPodSandboxRequest{
+		Filter: &runtimeapi.PodSandboxFilter{
+			State: &runtimeapi.PodSandboxStateValue{State: runtimeapi.PodSandboxState_SANDBOX_READY},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to list pod sandboxes: %w", err)
+	}
+
+	pods := make(map[string]*runtimeapi.PodSandboxMetadata, len(podResp.Items))
+	for _, pod := range podResp.Items {
+		pods[pod.Id] = pod.Metadata
+	}
+
+	containerResp, err := inv.criClient.ListContainers(ctx, &runtimeapi.ListContainersRequest{
+		Filter: &runtimeapi.ContainerFilter{
+			State: &runtimeapi.ContainerStateValue{State: runtimeapi.ContainerState_CONTAINER_RUNNING},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to list containers: %w", err)
+	}
+
+	// Keep the entries of containers that are already in the inventory.
+	containers := make(map[string]Container, len(containerResp.Containers))
+	var added []*runtimeapi.Container
+	inv.mu.RLock()
+	for _, c := range containerResp.Containers {
+		if existing, found := inv.containers[c.Id]; found {
+			containers[c.Id] = existing
+		} else {
+			added = append(added, c)
+		}
+	}
+	inv.mu.RUnlock()
+
+	for _, c := range added {
+		if container, ok := inv.newContainer(ctx, c.Id, c.PodSandboxId, pods[c.PodSandboxId], c.Metadata, c.CreatedAt); ok {
+			containers[c.Id] = container
+		}
+	}
+
+	inv.mu.Lock()
+	inv.containers = containers
+	inv.synced = true
+	inv.mu.Unlock()
+
+	slog.Info("Container inventory synchronized", "containers", len(containers))
+	return nil
+}
+
+// newContainer creates an inventory entry, or returns false if the container is filtered out.
+func (inv *ContainerInventory) newContainer(ctx context.Context, id, sandboxID string, pod *runtimeapi.PodSandboxMetadata, metadata *runtimeapi.ContainerMetadata, createdAt int64) (Container, bool) {
+	if pod == nil || metadata == nil {
+		return Container{}, false
+	}
+
+	if !inv.config.MatchesContainer(pod.Namespace, pod.Name, metadata.Name) {
+		slog.Debug("Container filtered out", "namespace", pod.Namespace, "pod", pod.Name, "container", metadata.Name)
+		return Container{}, false
+	}
+
+	container := Container{
+		ID:        id,
+		SandboxID: sandboxID,
+		Namespace: pod.Namespace,
+		Pod:       pod.Name,
+		Container: metadata.Name,
+		CreatedAt: createdAt,
+	}
+
+	// Look up the cgroup path once per container, so that cgroup resolution does not need to
+	// talk to the container runtime when /proc does not tell the cgroup.
+	cgroupsPath, err := getContainerCgroupsPath(ctx, inv.criClient, id)
+	if err != nil {
+		slog.Debug("Failed to get cgroups path from CRI", "id", id, "error", err)
+	}
+	container.CRICgroupPath = cgroupsPath
+
+	return container, true
+}
+
+// watchEvents passes container events from the stream to run, reconnecting the stream if it breaks.
+// The error is that of opening the stream.
+func (inv *ContainerInventory) watchEvents(ctx context.Context, stream runtimeapi.RuntimeService_GetContainerEventsClient, err error) {
+	for {
+		if err == nil {
+			err = inv.streamEvents(ctx, stream)
+		}
+		if ctx.Err() != nil {
+			return
+		}
+
+		if status.Code(err) == codes.Unimplemented {
+			slog.Info("Container runtime does not support container events, relying on periodic resync", "resync_interval", inv.config.DiscoveryResyncInterval)
+			return
+		}
+
+		slog.Warn("Container event stream failed, reconnecting", "error", err, "delay", eventStreamRetryDelay)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(eventStreamRetryDelay):
+		}
+
+		// Events may have been missed while the stream was down.
+		stream, err = inv.criClient.GetContainerEvents(ctx, &runtimeapi.GetEventsRequest{})
+		inv.requestResync()
+	}
+}
+
+func (inv *ContainerInventory) streamEvents(ctx context.Context, stream runtimeapi.RuntimeService_GetContainerEventsClient) error {
+	slog.Debug("Watching container events")
+	for {
+		event, err := stream.Recv()
+		if err != nil {
+			return err
+		}
+
+		select {
+		case inv.events <- event:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func (inv *ContainerInventory) handleEvent(ctx context.Context, event *runtimeapi.ContainerEventResponse) {
+	slog.Debug("Received container event", "id", event.ContainerId, "type", event.ContainerEventType)
+
+	switch event.ContainerEventType {
+	case runtimeapi.ContainerEventType_CONTAINER_STARTED_EVENT:
+		var metadata *runtimeapi.ContainerMetadata
+		var createdAt int64
+		for _, s := range event.ContainersStatuses {
+			if s.Id == event.ContainerId {
+				metadata = s.Metadata
+				createdAt = s.CreatedAt
+				break
+			}
+		}
+
+		if event.PodSandboxStatus == nil || event.PodSandboxStatus.Metadata == nil || metadata == nil {
+			// Older runtimes do not include the statuses in the event.
+			inv.requestResync()
+			return
+		}
+
+		container, ok := inv.newContainer(ctx, event.ContainerId, event.PodSandboxStatus.Id, event.PodSandboxStatus.Metadata, metadata, createdAt)
+		if !ok {
+			return
+		}
+
+		inv.mu.Lock()
+		inv.containers[container.ID] = container
+		inv.mu.Unlock()
+
+		slog.Debug("Container added to inventory", "namespace", container.Namespace, "pod", container.Pod, "container", container.Container)
+
+	case runtimeapi.ContainerEventType_CONTAINER_STOPPED_EVENT, runtimeapi.ContainerEventType_CONTAINER_DELETED_EVENT:
+		inv.mu.Lock()
+		delete(inv.containers, event.ContainerId)
+		inv.mu.Unlock()
+	}
+}
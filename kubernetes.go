@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"log/slog"
 	"os"
@@ -17,20 +18,46 @@ import (
 type KubernetesClient struct {
 	criClient runtimeapi.RuntimeServiceClient
 	config    *Config
+	inventory *ContainerInventory
 }
 
 type Container struct {
 	ID        string
+	SandboxID string
 	Namespace string
 	Pod       string
 	Container string
+	CreatedAt int64
 	PIDs      []ProcessInfo
+
+	// ProcCgroup is the content of /proc/<pid>/cgroup of a process in the container.
+	ProcCgroup string
+
+	// CRICgroupPath is the cgroup path of the container relative to the cgroup root,
+	// as reported by the container runtime.
+	CRICgroupPath string
 }
 
 type ProcessInfo struct {
-	PID   int
-	NSPID int
-	Comm  string
+	PID    int
+	NSPID  int
+	Comm   string
+	Status ProcessStatus
+}
+
+// ProcessStatus holds the values read from /proc/<pid>/status. Memory sizes are in bytes.
+// Fields that are not present, such as the memory sizes of kernel threads, are zero.
+type ProcessStatus struct {
+	VmRSS                    int64
+	RssAnon                  int64
+	RssFile                  int64
+	RssShmem                 int64
+	VmHWM                    int64
+	VmSwap                   int64
+	VmPTE                    int64
+	Threads                  int64
+	VoluntaryCtxtSwitches    int64
+	NonvoluntaryCtxtSwitches int64
 }
 
 func NewKubernetesClient(config *Config) (*KubernetesClient, error) {
@@ -44,71 +71,41 @@ func NewKubernetesClient(config *Config) (*KubernetesClient, error) {
 		return nil, fmt.Errorf("failed to connect to CRI socket: %w", err)
 	}
 
+	criClient := runtimeapi.NewRuntimeServiceClient(conn)
+
 	return &KubernetesClient{
-		criClient: runtimeapi.NewRuntimeServiceClient(conn),
+		criClient: criClient,
 		config:    config,
+		inventory: NewContainerInventory(criClient, config),
 	}, nil
 }
 
-func (k *KubernetesClient) DiscoverContainers(ctx context.Context) ([]Container, error) {
+// Start populates the container inventory and keeps it current in the background.
+func (k *KubernetesClient) Start(ctx context.Context) {
+	k.inventory.Start(ctx)
+}
+
+// DiscoverContainers returns the containers in the inventory with their processes.
+func (k *KubernetesClient) DiscoverContainers() ([]Container, error) {
 	slog.Debug("Discovering containers")
 
-	// List all pods.
-	resp, err := k.criClient.ListPodSandbox(ctx, &runtimeapi.ListPodSandboxRequest{})
+	containers, err := k.inventory.Containers()
 	if err != nil {
-		return nil, fmt.Errorf("failed to list pod sandboxes: %w", err)
-	}
-
-	var containers []Container
-
-	for _, pod := range resp.Items {
-		if pod.State != runtimeapi.PodSandboxState_SANDBOX_READY {
-			continue
-		}
-
-		namespace := pod.Metadata.Namespace
-		podName := pod.Metadata.Name
-
-		// List containers in this pod.
-		containerResp, err := k.criClient.ListContainers(ctx, &runtimeapi.ListContainersRequest{
-			Filter: &runtimeapi.ContainerFilter{
-				PodSandboxId: pod.Id,
-			},
-		})
-		if err != nil {
-			slog.Warn("Failed to list containers for pod", "pod", podName, "error", err)
-			continue
-		}
-
-		for _, c := range containerResp.Containers {
-			if c.State != runtimeapi.ContainerState_CONTAINER_RUNNING {
-				continue
-			}
-
-			containerName := c.Metadata.Name
-
-			// Apply filter.
-			if !k.config.MatchesContainer(namespace, podName, containerName) {
-				slog.Debug("Container filtered out", "namespace", namespace, "pod", podName, "container", containerName)
-				continue
-			}
-
-			containers = append(containers, Container{
-				ID:        c.Id,
-				Namespace: namespace,
-				Pod:       podName,
-				Container: containerName,
-			})
-		}
+		return nil, err
 	}
 
 	// Scan /proc and populate PIDs for all containers.
 	k.populateContainerProcesses(containers)
 
-	slog.Info("Container discovery complete", "containers", len(containers))
+	slog.Debug("Container discovery complete", "containers", len(containers))
 	return containers, nil
 }
 
+// Containers returns the containers in the inventory without their processes.
+func (k *KubernetesClient) Containers() ([]Container, error) {
+	return k.inventory.Containers()
+}
+
 // populateContainerProcesses scans /proc once and populates the PIDs field for all containers that match the configured filters.
 func (k *KubernetesClient) populateContainerProcesses(containers []Container) {
 	entries, err := os.ReadDir(k.config.Paths.Proc)
@@ -117,6 +114,12 @@ func (k *KubernetesClient) populateContainerProcesses(containers []Container) {
 		return
 	}
 
+	// Index containers by ID for looking up the container of each process.
+	byID := make(map[string]*Container, len(containers))
+	for i := range containers {
+		byID[containers[i].ID] = &containers[i]
+	}
+
 	for _, entry := range entries {
 		if !entry.IsDir() {
 			continue
@@ -128,29 +131,37 @@ func (k *KubernetesClient) populateContainerProcesses(containers []Container) {
 			continue // Not a PID directory.
 		}
 
-		// Get cgroup and command for this PID.
+		// Check if this process belongs to any of our containers.
 		cgroup, err := k.readCgroup(pid)
 		if err != nil {
 			continue
 		}
 
+		container, found := byID[parseContainerID(cgroup)]
+		if !found {
+			continue
+		}
+
+		if container.ProcCgroup == "" {
+			container.ProcCgroup = cgroup
+		}
+
+		// Get command for this PID.
 		comm, err := k.getComm(pid)
 		if err != nil {
 			continue
 		}
 
-		nsPID, err := k.getNamespacePID(pid)
-		if err != nil {
+		if !k.config.MatchesProcess(container.Namespace, container.Pod, container.Container, comm) {
 			continue
 		}
 
-		// Check if this process belongs to any of our containers.
-		for i := range containers {
-			if strings.Contains(cgroup, containers[i].ID) && k.config.MatchesProcess(containers[i].Namespace, containers[i].Pod, containers[i].Container, comm) {
-				containers[i].PIDs = append(containers[i].PIDs, ProcessInfo{PID: pidInt, NSPID: nsPID, Comm: comm})
-				break // Process belongs to only one container.
-			}
+		nsPID, status, err := k.getProcessStatus(pid)
+		if err != nil {
+			continue
 		}
+
+		container.PIDs = append(container.PIDs, ProcessInfo{PID: pidInt, NSPID: nsPID, Comm: comm, Status: status})
 	}
 
 	// Log discovered processes for each container.
@@ -159,6 +170,64 @@ func (k *KubernetesClient) populateContainerProcesses(containers []Container) {
 	}
 }
 
+// containerScopePrefixes lists the prefixes of the container cgroups created by containerd (cri-containerd-<id>.scope),
+// CRI-O (crio-<id>.scope, or crio-<id> with the cgroupfs cgroup driver) and cri-dockerd (docker-<id>.scope).
+var containerScopePrefixes = []string{"cri-containerd-", "crio-", "docker-"}
+
+// parseContainerID returns the container ID from the contents of /proc/<pid>/cgroup, or an empty string if
+// the process is not in a container cgroup. The container cgroup is the last component of the cgroup path
+// that names a container: either a systemd scope unit or, with the cgroupfs cgroup driver, the bare ID.
+// The process may be in a child cgroup of the container cgroup, e.g. when running systemd in the container.
+func parseContainerID(cgroup string) string {
+	for _, line := range strings.Split(cgroup, "\n") {
+		// hierarchy-ID:controller-list:cgroup-path
+		parts := strings.SplitN(line, ":", 3)
+		if len(parts) != 3 {
+			continue
+		}
+
+		components := strings.Split(parts[2], "/")
+		for i := len(components) - 1; i >= 0; i-- {
+			if id := cgroupContainerID(components[i]); id != "" {
+				return id
+			}
+		}
+	}
+	return ""
+}
+
+// cgroupContainerID returns the container ID named by a cgroup directory name, or an empty string if the
+// name is not a container cgroup. The name is the ID, optionally with a known prefix and a ".scope" suffix.
+// Other cgroups with the ID in their name, such as the crio-conmon-<id>.scope of the CRI-O monitor process,
+// are not container cgroups.
+func cgroupContainerID(name string) string {
+	name = strings.TrimSuffix(name, ".scope")
+	for _, prefix := range containerScopePrefixes {
+		if id, found := strings.CutPrefix(name, prefix); found {
+			name = id
+			break
+		}
+	}
+	if isContainerID(name) {
+		return name
+	}
+	return ""
+}
+
+// isContainerID checks if the string is a 64 character hexadecimal container ID.
+func isContainerID(s string) bool {
+	if len(s) != 64 {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+	return true
+}
+
 func (k *KubernetesClient) readCgroup(pid string) (string, error) {
 	cgroupPath := filepath.Join(k.config.Paths.Proc, pid, "cgroup")
 	data, err := os.ReadFile(cgroupPath)
@@ -177,26 +246,110 @@ func (k *KubernetesClient) getComm(pid string) (string, error) {
 	return strings.TrimSpace(string(data)), nil
 }
 
-func (k *KubernetesClient) getNamespacePID(pid string) (int, error) {
+// getProcessStatus reads /proc/<pid>/status and returns the PID of the process in its PID namespace,
+// and the memory, thread and context switch values of the process.
+func (k *KubernetesClient) getProcessStatus(pid string) (int, ProcessStatus, error) {
 	statusPath := filepath.Join(k.config.Paths.Proc, pid, "status")
 	data, err := os.ReadFile(statusPath)
 	if err != nil {
-		return 0, err
+		return 0, ProcessStatus{}, err
 	}
 
+	var status ProcessStatus
+	nsPID := -1
 	for _, line := range strings.Split(string(data), "\n") {
-		if strings.HasPrefix(line, "NSpid:") {
-			fields := strings.Fields(line)
-			if len(fields) < 2 {
-				break
-			}
-			nsPID, err := strconv.Atoi(fields[len(fields)-1])
+		key, value, found := strings.Cut(line, ":")
+		if !found {
+			continue
+		}
+		fields := strings.Fields(value)
+		if len(fields) == 0 {
+			continue
+		}
+
+		if key == "NSpid" {
+			// The last value is the PID in the innermost PID namespace.
+			nsPID, err = strconv.Atoi(fields[len(fields)-1])
 			if err != nil {
-				return 0, err
+				return 0, ProcessStatus{}, err
 			}
-			return nsPID, nil
+			continue
+		}
+
+		var field *int64
+		scale := int64(1)
+		switch key {
+		case "VmRSS":
+			field, scale = &status.VmRSS, 1024
+		case "RssAnon":
+			field, scale = &status.RssAnon, 1024
+		case "RssFile":
+			field, scale = &status.RssFile, 1024
+		case "RssShmem":
+			field, scale = &status.RssShmem, 1024
+		case "VmHWM":
+			field, scale = &status.VmHWM, 1024
+		case "VmSwap":
+			field, scale = &status.VmSwap, 1024
+		case "VmPTE":
+			field, scale = &status.VmPTE, 1024
+		case "Threads":
+			field = &status.Threads
+		case "voluntary_ctxt_switches":
+			field = &status.VoluntaryCtxtSwitches
+		case "nonvoluntary_ctxt_switches":
+			field = &status.NonvoluntaryCtxtSwitches
+		default:
+			continue
 		}
+
+		v, err := strconv.ParseInt(fields[0], 10, 64)
+		if err != nil {
+			slog.Debug("Failed to parse process status field", "pid", pid, "field", key, "error", err)
+			continue
+		}
+		*field = v * scale
+	}
+
+	if nsPID < 0 {
+		return 0, ProcessStatus{}, fmt.Errorf("NSpid not found for pid %s", pid)
+	}
+	return nsPID, status, nil
+}
+
+// getContainerCgroupsPath returns the cgroupsPath of the OCI runtime spec of the container,
+// converted to a path relative to the cgroup root.
+// It is read from the verbose info of the CRI ContainerStatus response, which both containerd
+// and CRI-O populate with the runtime spec.
+func getContainerCgroupsPath(ctx context.Context, criClient runtimeapi.RuntimeServiceClient, id string) (string, error) {
+	resp, err := criClient.ContainerStatus(ctx, &runtimeapi.ContainerStatusRequest{
+		ContainerId: id,
+		Verbose:     true,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to get container status: %w", err)
+	}
+
+	info, found := resp.Info["info"]
+	if !found {
+		return "", fmt.Errorf("container status has no verbose info")
+	}
+
+	var verboseInfo struct {
+		RuntimeSpec struct {
+			Linux struct {
+				CgroupsPath string `json:"cgroupsPath"`
+			} `json:"linux"`
+		} `json:"runtimeSpec"`
+	}
+	if err := json.Unmarshal([]byte(info), &verboseInfo); err != nil {
+		return "", fmt.Errorf("failed to parse container status verbose info: %w", err)
+	}
+
+	cgroupsPath := verboseInfo.RuntimeSpec.Linux.CgroupsPath
+	if cgroupsPath == "" {
+		return "", fmt.Errorf("cgroupsPath not found in container status verbose info")
 	}
 
-	return 0, fmt.Errorf("NSpid not found for pid %s", pid)
+	return systemdCgroupPath(cgroupsPath), nil
 }
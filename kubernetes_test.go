@@ -0,0 +1,368 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+const testContainerID = "4a3b8c2d1e0f9a8b7c6d5e4f3a2b1c0d9e8f7a6b5c4d3e2f1a0b9c8d7e6f5a4b"
+
+func TestParseContainerID(t *testing.T) {
+	tests := []struct {
+		name   string
+		cgroup string
+		want   string
+	}{
+		{
+			name:   "containerd",
+			cgroup: "0::/kubepods.slice/kubepods-burstable.slice/kubepods-burstable-pod1234.slice/cri-containerd-" + testContainerID + ".scope\n",
+			want:   testContainerID,
+		},
+		{
+			name:   "containerd child cgroup",
+			cgroup: "0::/kubepods.slice/kubepods-pod1234.slice/cri-containerd-" + testContainerID + ".scope/init.scope\n",
+			want:   testContainerID,
+		},
+		{
+			name:   "cri-o",
+			cgroup: "0::/kubepods.slice/kubepods-besteffort.slice/kubepods-besteffort-pod1234.slice/crio-" + testContainerID + ".scope\n",
+			want:   testContainerID,
+		},
+		{
+			name:   "cri-o conmon",
+			cgroup: "0::/kubepods.slice/kubepods-besteffort.slice/kubepods-besteffort-pod1234.slice/crio-conmon-" + testContainerID + ".scope\n",
+			want:   "",
+		},
+		{
+			name:   "cri-o cgroupfs driver",
+			cgroup: "0::/kubepods/besteffort/pod1234/crio-" + testContainerID + "\n",
+			want:   testContainerID,
+		},
+		{
+			name:   "cri-o conmon cgroupfs driver",
+			cgroup: "0::/kubepods/besteffort/pod1234/crio-conmon-" + testContainerID + "\n",
+			want:   "",
+		},
+		{
+			name:   "cri-dockerd",
+			cgroup: "0::/kubepods.slice/kubepods-pod1234.slice/docker-" + testContainerID + ".scope\n",
+			want:   testContainerID,
+		},
+		{
+			name:   "cgroupfs driver",
+			cgroup: "0::/kubepods/burstable/pod1234/" + testContainerID + "\n",
+			want:   testContainerID,
+		},
+		{
+			name: "cgroup v1",
+			cgroup: "12:pids:/kubepods/besteffort/pod1234/" + testContainerID + "\n" +
+				"11:memory:/kubepods/besteffort/pod1234/" + testContainerID + "\n" +
+				"1:name=systemd:/kubepods/besteffort/pod1234/" + testContainerID + "\n",
+			want: testContainerID,
+		},
+		{
+			name:   "host process",
+			cgroup: "0::/system.slice/containerd.service\n",
+			want:   "",
+		},
+		{
+			name:   "unknown scope prefix",
+			cgroup: "0::/system.slice/unknown-" + testContainerID + ".scope\n",
+			want:   "",
+		},
+		{
+			name:   "uppercase ID",
+			cgroup: "0::/kubepods/pod1234/" + strings.ToUpper(testContainerID) + "\n",
+			want:   "",
+		},
+		{
+			name:   "empty",
+			cgroup: "",
+			want:   "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseContainerID(tt.cgroup); got != tt.want {
+				t.Errorf("parseContainerID() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSystemdCgroupPath(t *testing.T) {
+	tests := []struct {
+		name        string
+		cgroupsPath string
+		want        string
+	}{
+		{
+			name:        "containerd",
+			cgroupsPath: "kubepods-besteffort-pod1234.slice:cri-containerd:" + testContainerID,
+			want:        "/kubepods.slice/kubepods-besteffort.slice/kubepods-besteffort-pod1234.slice/cri-containerd-" + testContainerID + ".scope",
+		},
+		{
+			name:        "guaranteed pod",
+			cgroupsPath: "kubepods-pod1234.slice:crio:" + testContainerID,
+			want:        "/kubepods.slice/kubepods-pod1234.slice/crio-" + testContainerID + ".scope",
+		},
+		{
+			name:        "no prefix",
+			cgroupsPath: "kubepods-pod1234.slice::" + testContainerID,
+			want:        "/kubepods.slice/kubepods-pod1234.slice/" + testContainerID + ".scope",
+		},
+		{
+			name:        "root slice",
+			cgroupsPath: "-.slice:docker:" + testContainerID,
+			want:        "/docker-" + testContainerID + ".scope",
+		},
+		{
+			name:        "empty slice",
+			cgroupsPath: ":docker:" + testContainerID,
+			want:        "/docker-" + testContainerID + ".scope",
+		},
+		{
+			name:        "cgroupfs driver",
+			cgroupsPath: "/kubepods/burstable/pod1234/" + testContainerID,
+			want:        "/kubepods/burstable/pod1234/" + testContainerID,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := systemdCgroupPath(tt.cgroupsPath); got != tt.want {
+				t.Errorf("systemdCgroupPath() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestContainerCgroupPath(t *testing.T) {
+	tests := []struct {
+		name    string
+		relPath string
+		want    string
+	}{
+		{
+			name:    "container cgroup",
+			relPath: "/kubepods.slice/kubepods-pod1234.slice/cri-containerd-" + testContainerID + ".scope",
+			want:    "/kubepods.slice/kubepods-pod1234.slice/cri-containerd-" + testContainerID + ".scope",
+		},
+		{
+			name:    "child cgroup",
+			relPath: "/kubepods.slice/kubepods-pod1234.slice/cri-containerd-" + testContainerID + ".scope/init.scope",
+			want:    "/kubepods.slice/kubepods-pod1234.slice/cri-containerd-" + testContainerID + ".scope",
+		},
+		{
+			name:    "cgroupfs driver",
+			relPath: "/kubepods/burstable/pod1234/" + testContainerID,
+			want:    "/kubepods/burstable/pod1234/" + testContainerID,
+		},
+		{
+			name:    "cri-o conmon",
+			relPath: "/kubepods.slice/kubepods-pod1234.slice/crio-conmon-" + testContainerID + ".scope",
+			want:    "",
+		},
+		{
+			name:    "other container",
+			relPath: "/kubepods.slice/kubepods-pod1234.slice/cri-containerd-" + strings.Repeat("0", 64) + ".scope",
+			want:    "",
+		},
+		{
+			name:    "pod cgroup",
+			relPath: "/kubepods.slice/kubepods-pod1234.slice",
+			want:    "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := containerCgroupPath(tt.relPath, testContainerID); got != tt.want {
+				t.Errorf("containerCgroupPath() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseCgroupPath(t *testing.T) {
+	const v1 = "12:pids:/kubepods/besteffort/pod1234/" + testContainerID + "\n" +
+		"11:cpu,cpuacct:/kubepods/besteffort/pod1234/" + testContainerID + "\n" +
+		"4:memory:/kubepods/besteffort/pod1234/" + testContainerID + "\n" +
+		"1:name=systemd:/kubepods/besteffort/pod1234/" + testContainerID + "\n"
+	const hybrid = "4:memory:/kubepods/besteffort/pod1234/" + testContainerID + "\n" +
+		"0::/kubepods/besteffort/pod1234/" + testContainerID + "/init\n"
+
+	tests := []struct {
+		name      string
+		data      string
+		hierarchy CgroupHierarchy
+		want      string
+	}{
+		{
+			name:      "cgroup v2",
+			data:      "0::/kubepods.slice/kubepods-pod1234.slice/cri-containerd-" + testContainerID + ".scope\n",
+			hierarchy: CgroupV2,
+			want:      "/kubepods.slice/kubepods-pod1234.slice/cri-containerd-" + testContainerID + ".scope",
+		},
+		{
+			name:      "cgroup v1",
+			data:      v1,
+			hierarchy: CgroupV1,
+			want:      "/kubepods/besteffort/pod1234/" + testContainerID,
+		},
+		{
+			name:      "hybrid",
+			data:      hybrid,
+			hierarchy: CgroupHybrid,
+			want:      "/kubepods/besteffort/pod1234/" + testContainerID,
+		},
+		{
+			name:      "hybrid read as cgroup v2",
+			data:      hybrid,
+			hierarchy: CgroupV2,
+			want:      "/kubepods/besteffort/pod1234/" + testContainerID + "/init",
+		},
+		{
+			name:      "cgroup v1 read as cgroup v2",
+			data:      v1,
+			hierarchy: CgroupV2,
+			want:      "",
+		},
+		{
+			name:      "no memory controller",
+			data:      "12:pids:/kubepods/besteffort/pod1234/" + testContainerID + "\n",
+			hierarchy: CgroupV1,
+			want:      "",
+		},
+		{
+			name:      "empty",
+			data:      "",
+			hierarchy: CgroupV2,
+			want:      "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseCgroupPath(tt.data, tt.hierarchy); got != tt.want {
+				t.Errorf("parseCgroupPath() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// writeProcess writes the /proc files of a process read by populateContainerProcesses.
+func writeProcess(tb testing.TB, proc string, pid int, cgroup, comm string) {
+	tb.Helper()
+	dir := filepath.Join(proc, fmt.Sprint(pid))
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		tb.Fatal(err)
+	}
+	status := fmt.Sprintf("Name:\t%s\nNSpid:\t%d\t1\nVmHWM:\t    2048 kB\nVmRSS:\t    1024 kB\nThreads:\t4\n", comm, pid)
+	for name, data := range map[string]string{"cgroup": cgroup, "comm": comm + "\n", "status": status} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(data), 0o644); err != nil {
+			tb.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkPopulateContainerProcesses(b *testing.B) {
+	const (
+		processes  = 10000
+		containers = 100
+	)
+
+	// Half of the processes are in containers, the rest are host processes.
+	proc := b.TempDir()
+	var ids []string
+	for i := range containers {
+		ids = append(ids, fmt.Sprintf("%064x", i+1))
+	}
+	for pid := 1; pid <= processes; pid++ {
+		cgroup := "0::/system.slice/containerd.service\n"
+		if pid%2 == 0 {
+			i := pid / 2 % containers
+			cgroup = fmt.Sprintf("0::/kubepods.slice/kubepods-pod%d.slice/cri-containerd-%s.scope\n", i, ids[i])
+		}
+		writeProcess(b, proc, pid, cgroup, "app")
+	}
+
+	k := &KubernetesClient{config: &Config{
+		Paths:   PathsConfig{Proc: proc},
+		Filters: []ContainerFilter{{Namespace: "*", Pod: "*", Container: "*", Command: "*"}},
+	}}
+
+	for _, bm := range []struct {
+		name     string
+		populate func([]Container)
+	}{
+		{"index", k.populateContainerProcesses},
+		{"contains", func(containers []Container) { containsPopulateContainerProcesses(k, containers) }},
+	} {
+		b.Run(bm.name, func(b *testing.B) {
+			b.ReportAllocs()
+			for b.Loop() {
+				discovered := make([]Container, len(ids))
+				for i, id := range ids {
+					discovered[i] = Container{ID: id, Namespace: "default", Pod: fmt.Sprint("pod", i), Container: "app"}
+				}
+				bm.populate(discovered)
+
+				found := 0
+				for _, container := range discovered {
+					found += len(container.PIDs)
+				}
+				if found != processes/2 {
+					b.Fatalf("found %d container processes, want %d", found, processes/2)
+				}
+			}
+		})
+	}
+}
+
+// containsPopulateContainerProcesses is the process discovery that populateContainerProcesses replaced, kept as
+// a reference for benchmarking. It reads all files of every process, and matches the cgroup of the process
+// against the ID of each container.
+func containsPopulateContainerProcesses(k *KubernetesClient, containers []Container) {
+	entries, err := os.ReadDir(k.config.Paths.Proc)
+	if err != nil {
+		return
+	}
+
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+
+		pid := entry.Name()
+		pidInt, err := strconv.Atoi(pid)
+		if err != nil {
+			continue
+		}
+
+		cgroup, err := k.readCgroup(pid)
+		if err != nil {
+			continue
+		}
+		comm, err := k.getComm(pid)
+		if err != nil {
+			continue
+		}
+		nsPID, status, err := k.getProcessStatus(pid)
+		if err != nil {
+			continue
+		}
+
+		for i := range containers {
+			if strings.Contains(cgroup, containers[i].ID) && k.config.MatchesProcess(containers[i].Namespace, containers[i].Pod, containers[i].Container, comm) {
+				containers[i].PIDs = append(containers[i].PIDs, ProcessInfo{PID: pidInt, NSPID: nsPID, Comm: comm, Status: status})
+				break
+			}
+		}
+	}
+}
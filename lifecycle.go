@@ -0,0 +1,100 @@
+package main
+
+import (
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+)
+
+// labelDeleter is implemented by metric vectors (e.g. *prometheus.GaugeVec) and by CgroupCollector.
+type labelDeleter interface {
+	DeleteLabelValues(lvs ...string) bool
+}
+
+// labelDeleters converts a list of metric vectors for NewSeriesTracker.
+func labelDeleters[T labelDeleter](vecs []T) []labelDeleter {
+	deleters := make([]labelDeleter, 0, len(vecs))
+	for _, vec := range vecs {
+		deleters = append(deleters, vec)
+	}
+	return deleters
+}
+
+// SeriesTracker tracks which label sets were observed in each collection cycle and deletes the
+// label sets that have not been observed within the grace period from the tracked metric vectors.
+// Without it, series of deleted pods and exited processes would keep reporting their last value forever.
+type SeriesTracker struct {
+	mu          sync.Mutex
+	name        string
+	gracePeriod time.Duration
+	vecs        []labelDeleter
+	series      map[string]*trackedSeries
+	cycleStart  time.Time
+}
+
+type trackedSeries struct {
+	labels   []string
+	lastSeen time.Time
+}
+
+// NewSeriesTracker creates a tracker for metric vectors that share the same label names.
+func NewSeriesTracker(name string, gracePeriod time.Duration, vecs ...labelDeleter) *SeriesTracker {
+	return &SeriesTracker{
+		name:        name,
+		gracePeriod: gracePeriod,
+		vecs:        vecs,
+		series:      make(map[string]*trackedSeries),
+	}
+}
+
+// BeginCycle marks the start of a new collection cycle.
+func (t *SeriesTracker) BeginCycle(now time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.cycleStart = now
+}
+
+// Observe records that the label set was observed in the current collection cycle.
+func (t *SeriesTracker) Observe(labels ...string) {
+	key := seriesKey(labels)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if s, found := t.series[key]; found {
+		s.lastSeen = t.cycleStart
+		return
+	}
+	t.series[key] = &trackedSeries{
+		labels:   append([]string(nil), labels...),
+		lastSeen: t.cycleStart,
+	}
+}
+
+// Sweep deletes the label sets that were not observed within the grace period before the current cycle.
+func (t *SeriesTracker) Sweep() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	deleted := 0
+	for key, s := range t.series {
+		if t.cycleStart.Sub(s.lastSeen) <= t.gracePeriod {
+			continue
+		}
+		for _, vec := range t.vecs {
+			vec.DeleteLabelValues(s.labels...)
+		}
+		delete(t.series, key)
+		deleted++
+	}
+
+	if deleted > 0 {
+		slog.Debug("Deleted stale series", "tracker", t.name, "deleted", deleted, "remaining", len(t.series))
+	}
+}
+
+// seriesKey returns a key that uniquely identifies a label set.
+func seriesKey(labels []string) string {
+	return strings.Join(labels, "\xff")
+}
@@ -10,6 +10,7 @@ import (
 	"strings"
 	"syscall"
 
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
@@ -53,6 +54,7 @@ func main() {
 	slog.Info("Starting container-resource-exporter",
 		"config", *configPath,
 		"address", config.Server.Address,
+		"collection_mode", config.CollectionMode,
 		"scrape_interval", config.ScrapeInterval,
 		"log_level", config.LogLevel,
 	)
@@ -63,13 +65,27 @@ func main() {
 		os.Exit(1)
 	}
 
-	// Start collector,
-	collector := NewCollector(config, kubeClient)
+	hierarchy, err := DetectCgroupHierarchy(config.Paths.Cgroup)
+	if err != nil {
+		slog.Error("Failed to detect cgroup hierarchy", "error", err)
+		os.Exit(1)
+	}
+	slog.Info("Detected cgroup hierarchy", "hierarchy", hierarchy, "path", config.Paths.Cgroup)
 
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	go collector.Start(ctx)
+	// Start container discovery.
+	kubeClient.Start(ctx)
+
+	// Start collector,
+	collector := NewCollector(config, kubeClient, hierarchy)
+	prometheus.MustRegister(collector)
+
+	// In on_scrape mode, metrics are collected when the exporter is scraped.
+	if config.CollectionMode == CollectionModeInterval {
+		go collector.Start(ctx)
+	}
 
 	// Setup HTTP server.
 	mux := http.NewServeMux()
@@ -1,491 +1,1048 @@
 package main
 
 import (
+	"slices"
+	"strings"
+
 	"github.com/prometheus/client_golang/prometheus"
-	"github.com/prometheus/client_golang/prometheus/promauto"
 )
 
+// Metric describes a value read from a cgroup file and exported as a const metric.
+// Metrics are created from CgroupMetricConfig, see defaultCgroupMetrics for the built-in metrics.
 type Metric struct {
-	gauge           *prometheus.GaugeVec
-	counter         *prometheus.CounterVec
+	desc            *prometheus.Desc
+	valueType       prometheus.ValueType
 	cgroupFile      string
 	cgroupFileField string
+	// cgroupFileIndex selects the value by position in files that have several values on a single line,
+	// such as cpu.max. Used when cgroupFileField is empty. Cgroup v1 files always have a single value.
+	cgroupFileIndex int
+	// scale converts the value to the unit of the metric, if different.
+	scale float64
+
+	// Equivalent value on cgroup v1. Metrics without cgroupV1File are not available on cgroup v1.
+	cgroupV1File      string
+	cgroupV1FileField string
+	// cgroupV1Scale converts the cgroup v1 value to the unit of the metric, if different.
+	cgroupV1Scale float64
 }
 
-// Cgroup v2 metrics
-// https://docs.kernel.org/admin-guide/cgroup-v2.html
+func newMetric(config CgroupMetricConfig) Metric {
+	valueType := prometheus.GaugeValue
+	if config.Type == MetricTypeCounter {
+		valueType = prometheus.CounterValue
+	}
 
-var cgroupMetrics = []Metric{
-	// Memory
+	help := config.Help
+	if help == "" {
+		help = "Value of the cgroup file (from " + metricSource(config.File, config.Field) + ")."
+	}
+
+	return Metric{
+		desc:              prometheus.NewDesc(config.Name, help, cgroupLabels, nil),
+		valueType:         valueType,
+		cgroupFile:        config.File,
+		cgroupFileField:   config.Field,
+		cgroupFileIndex:   config.Index,
+		scale:             config.Scale,
+		cgroupV1File:      config.V1File,
+		cgroupV1FileField: config.V1Field,
+		cgroupV1Scale:     config.V1Scale,
+	}
+}
+
+// metricSource formats the cgroup file and optional field of a metric as in the metric descriptions.
+func metricSource(file, field string) string {
+	if field == "" {
+		return file
+	}
+	return file + ":" + field
+}
+
+// nanosecondsToMicroseconds converts cgroup v1 nanosecond values to the microseconds used by cgroup v2.
+const nanosecondsToMicroseconds = 1e-3
+
+// PressureMetric describes the metrics read from a Pressure Stall Information (PSI) file.
+// Each metric has the "kind" label telling if the line is for "some" or "full" stall.
+type PressureMetric struct {
+	total      *prometheus.Desc
+	avg10      *prometheus.Desc
+	avg60      *prometheus.Desc
+	avg300     *prometheus.Desc
+	cgroupFile string
+}
+
+var cgroupPressureLabels = []string{"namespace", "pod", "container", "level", "subcgroup", "cgroup_path", "kind"}
+
+func newPressureMetric(resource string) PressureMetric {
+	file := resource + ".pressure"
+	return PressureMetric{
+		total: newBuiltinDesc(
+			"cgroup_"+resource+"_pressure_stalled_usec_total",
+			"Total time in microseconds in which some or all tasks of the cgroup were stalled waiting for "+resource+" (from "+file+":total).",
+			cgroupPressureLabels,
+		),
+		avg10: newBuiltinDesc(
+			"cgroup_"+resource+"_pressure_avg10_percent",
+			"Percentage of time in which some or all tasks of the cgroup were stalled waiting for "+resource+", averaged over 10 seconds (from "+file+":avg10).",
+			cgroupPressureLabels,
+		),
+		avg60: newBuiltinDesc(
+			"cgroup_"+resource+"_pressure_avg60_percent",
+			"Percentage of time in which some or all tasks of the cgroup were stalled waiting for "+resource+", averaged over 60 seconds (from "+file+":avg60).",
+			cgroupPressureLabels,
+		),
+		avg300: newBuiltinDesc(
+			"cgroup_"+resource+"_pressure_avg300_percent",
+			"Percentage of time in which some or all tasks of the cgroup were stalled waiting for "+resource+", averaged over 300 seconds (from "+file+":avg300).",
+			cgroupPressureLabels,
+		),
+		cgroupFile: file,
+	}
+}
+
+// Pressure Stall Information metrics, available on cgroup v2 only
+// https://docs.kernel.org/accounting/psi.html
+
+var cgroupPressureMetrics = []PressureMetric{
+	newPressureMetric("cpu"),
+	newPressureMetric("memory"),
+	newPressureMetric("io"),
+}
+
+// IOStatMetric describes a per-device counter read from io.stat.
+type IOStatMetric struct {
+	desc  *prometheus.Desc
+	field string
+}
+
+var cgroupIOLabels = []string{"namespace", "pod", "container", "level", "subcgroup", "cgroup_path", "device"}
+
+// I/O metrics, available on cgroup v2 only
+
+var cgroupIOStatMetrics = []IOStatMetric{
 	{
-		gauge: promauto.NewGaugeVec(
-			prometheus.GaugeOpts{
-				Name: "cgroup_memory_current_bytes",
-				Help: "Total memory currently used by the cgroup and its descendants, in bytes (from memory.current).",
-			},
-			[]string{"namespace", "pod", "container"},
+		desc: newBuiltinDesc(
+			"cgroup_io_read_bytes_total",
+			"Total number of bytes read from the device by the cgroup (from io.stat:rbytes).",
+			cgroupIOLabels,
 		),
-		cgroupFile: "memory.current",
+		field: "rbytes",
 	},
 	{
-		gauge: promauto.NewGaugeVec(
-			prometheus.GaugeOpts{
-				Name: "cgroup_memory_peak_bytes",
-				Help: "Maximum memory usage recorded for the cgroup and its descendants since creation or last reset (from memory.peak).",
-			},
-			[]string{"namespace", "pod", "container"},
+		desc: newBuiltinDesc(
+			"cgroup_io_write_bytes_total",
+			"Total number of bytes written to the device by the cgroup (from io.stat:wbytes).",
+			cgroupIOLabels,
 		),
-		cgroupFile: "memory.peak",
+		field: "wbytes",
 	},
 	{
-		gauge: promauto.NewGaugeVec(
-			prometheus.GaugeOpts{
-				Name: "cgroup_memory_low_bytes",
-				Help: "Best-effort memory protection threshold below which memory is not reclaimed (from memory.low).",
-			},
-			[]string{"namespace", "pod", "container"},
+		desc: newBuiltinDesc(
+			"cgroup_io_reads_total",
+			"Total number of read operations issued to the device by the cgroup (from io.stat:rios).",
+			cgroupIOLabels,
 		),
-		cgroupFile: "memory.low",
+		field: "rios",
 	},
 	{
-		gauge: promauto.NewGaugeVec(
-			prometheus.GaugeOpts{
-				Name: "cgroup_memory_high_bytes",
-				Help: "Memory usage throttle limit above which processes are throttled and put under reclaim pressure (from memory.high).",
-			},
-			[]string{"namespace", "pod", "container"},
+		desc: newBuiltinDesc(
+			"cgroup_io_writes_total",
+			"Total number of write operations issued to the device by the cgroup (from io.stat:wios).",
+			cgroupIOLabels,
 		),
-		cgroupFile: "memory.high",
+		field: "wios",
 	},
 	{
-		gauge: promauto.NewGaugeVec(
-			prometheus.GaugeOpts{
-				Name: "cgroup_memory_max_bytes",
-				Help: "Hard memory usage limit for the cgroup; exceeding this may trigger OOM killer (from memory.max).",
-			},
-			[]string{"namespace", "pod", "container"},
+		desc: newBuiltinDesc(
+			"cgroup_io_discard_bytes_total",
+			"Total number of bytes discarded on the device by the cgroup (from io.stat:dbytes).",
+			cgroupIOLabels,
 		),
-		cgroupFile: "memory.max",
+		field: "dbytes",
 	},
-	// memory.stat fields
 	{
-		gauge: promauto.NewGaugeVec(
-			prometheus.GaugeOpts{
-				Name: "cgroup_memory_stat_anon_bytes",
-				Help: "Amount of memory used in anonymous mappings such as brk(), sbrk(), and mmap(MAP_ANONYMOUS) (from memory.stat:anon).",
-			},
-			[]string{"namespace", "pod", "container"},
+		desc: newBuiltinDesc(
+			"cgroup_io_discards_total",
+			"Total number of discard operations issued to the device by the cgroup (from io.stat:dios).",
+			cgroupIOLabels,
 		),
-		cgroupFile:      "memory.stat",
-		cgroupFileField: "anon",
+		field: "dios",
 	},
+}
+
+var cgroupHugetlbLabels = []string{"namespace", "pod", "container", "level", "subcgroup", "cgroup_path", "page_size"}
+
+// Hugetlb metrics, read for each huge page size such as 2MB and 1GB.
+// The "%s" in file names is replaced with the page size.
+// https://docs.kernel.org/admin-guide/cgroup-v2.html#hugetlb
+
+var cgroupHugetlbMetrics = []Metric{
 	{
-		gauge: promauto.NewGaugeVec(
-			prometheus.GaugeOpts{
-				Name: "cgroup_memory_stat_file_bytes",
-				Help: "Amount of memory used to cache filesystem data, including tmpfs and shared memory (from memory.stat:file).",
-			},
-			[]string{"namespace", "pod", "container"},
+		desc: newBuiltinDesc(
+			"cgroup_hugetlb_current_bytes",
+			"Current usage of huge pages of the page size by the cgroup and its descendants (from hugetlb.<size>.current).",
+			cgroupHugetlbLabels,
 		),
-		cgroupFile:      "memory.stat",
-		cgroupFileField: "file",
+		valueType:    prometheus.GaugeValue,
+		cgroupFile:   "hugetlb.%s.current",
+		cgroupV1File: "hugetlb.%s.usage_in_bytes",
 	},
 	{
-		gauge: promauto.NewGaugeVec(
-			prometheus.GaugeOpts{
-				Name: "cgroup_memory_stat_shmem_bytes",
-				Help: "Amount of cached filesystem data that is swap-backed, such as tmpfs, shm segments, and shared anonymous mmap()s (from memory.stat:shmem).",
-			},
-			[]string{"namespace", "pod", "container"},
+		desc: newBuiltinDesc(
+			"cgroup_hugetlb_max_bytes",
+			"Hard limit of huge page usage of the page size, -1 if unlimited (from hugetlb.<size>.max).",
+			cgroupHugetlbLabels,
 		),
-		cgroupFile:      "memory.stat",
-		cgroupFileField: "shmem",
+		valueType:    prometheus.GaugeValue,
+		cgroupFile:   "hugetlb.%s.max",
+		cgroupV1File: "hugetlb.%s.limit_in_bytes",
 	},
 	{
-		gauge: promauto.NewGaugeVec(
-			prometheus.GaugeOpts{
-				Name: "cgroup_memory_stat_kernel_bytes",
-				Help: "Total kernel memory usage, including kernel_stack, pagetables, percpu, vmalloc, and slab (from memory.stat:kernel).",
-			},
-			[]string{"namespace", "pod", "container"},
+		desc: newBuiltinDesc(
+			"cgroup_hugetlb_events_max_total",
+			"Number of allocation failures of huge pages of the page size due to the limit (from hugetlb.<size>.events:max).",
+			cgroupHugetlbLabels,
 		),
-		cgroupFile:      "memory.stat",
-		cgroupFileField: "kernel",
+		valueType:       prometheus.CounterValue,
+		cgroupFile:      "hugetlb.%s.events",
+		cgroupFileField: "max",
+		cgroupV1File:    "hugetlb.%s.failcnt",
 	},
 	{
-		gauge: promauto.NewGaugeVec(
-			prometheus.GaugeOpts{
-				Name: "cgroup_memory_stat_slab_bytes",
-				Help: "Amount of memory used for storing in-kernel data structures (from memory.stat:slab).",
-			},
-			[]string{"namespace", "pod", "container"},
+		desc: newBuiltinDesc(
+			"cgroup_hugetlb_rsvd_current_bytes",
+			"Current reservations and no-reserve faults of huge pages of the page size (from hugetlb.<size>.rsvd.current).",
+			cgroupHugetlbLabels,
 		),
-		cgroupFile:      "memory.stat",
-		cgroupFileField: "slab",
+		valueType:    prometheus.GaugeValue,
+		cgroupFile:   "hugetlb.%s.rsvd.current",
+		cgroupV1File: "hugetlb.%s.rsvd.usage_in_bytes",
+	},
+}
+
+var cgroupNUMAStatLabels = []string{"namespace", "pod", "container", "level", "subcgroup", "cgroup_path", "type", "numa_node"}
+
+// NUMA metrics, memory.numa_stat is available on cgroup v2 only
+var (
+	cgroupMemoryNUMAStatBytes = newBuiltinDesc(
+		"cgroup_memory_numa_stat_bytes",
+		"Amount of memory in bytes of each type on each NUMA node (from memory.numa_stat).",
+		cgroupNUMAStatLabels,
+	)
+	cgroupMemoryNUMAStatTotal = newBuiltinDesc(
+		"cgroup_memory_numa_stat_total",
+		"Cumulative event count of each workingset event type on each NUMA node (from memory.numa_stat).",
+		cgroupNUMAStatLabels,
+	)
+	cgroupCpusetCpusEffectiveInfo = newBuiltinDesc(
+		"cgroup_cpuset_cpus_effective_info",
+		"CPUs granted to the cgroup by its parent, as the cpus label (from cpuset.cpus.effective).",
+		[]string{"namespace", "pod", "container", "level", "subcgroup", "cgroup_path", "cpus"},
+	)
+	cgroupCpusetMemsEffectiveInfo = newBuiltinDesc(
+		"cgroup_cpuset_mems_effective_info",
+		"NUMA memory nodes granted to the cgroup by its parent, as the mems label (from cpuset.mems.effective).",
+		[]string{"namespace", "pod", "container", "level", "subcgroup", "cgroup_path", "mems"},
+	)
+)
+
+var cgroupMemoryStatLabels = []string{"namespace", "pod", "container", "level", "subcgroup", "cgroup_path", "field"}
+
+// Metrics for all memory.stat fields, enabled by memory_stat_all_fields
+var (
+	cgroupMemoryStatFieldBytes = newBuiltinDesc(
+		"cgroup_memory_stat_field_bytes",
+		"Amount of memory in bytes for each field in memory.stat, labeled by field name (from memory.stat).",
+		cgroupMemoryStatLabels,
+	)
+	cgroupMemoryStatFieldTotal = newBuiltinDesc(
+		"cgroup_memory_stat_field_total",
+		"Cumulative event count for each event field in memory.stat, labeled by field name (from memory.stat).",
+		cgroupMemoryStatLabels,
+	)
+)
+
+// memoryStatCounterPrefixes lists the prefixes of memory.stat fields that are event counters rather than amounts of memory,
+// e.g. pgfault, pswpin, workingset_refault_anon, zswpout, thp_fault_alloc and numa_hint_faults.
+var memoryStatCounterPrefixes = []string{"pg", "pswp", "workingset_", "zswp", "thp_", "numa_"}
+
+// memoryStatGauges lists the memory.stat fields with a counter prefix that are not event counters,
+// such as workingset_nodes, the number of shadow nodes of the cgroup.
+var memoryStatGauges = []string{"workingset_nodes"}
+
+// isMemoryStatCounter checks if the memory.stat field is an event counter.
+// The "total_" prefix of hierarchical cgroup v1 fields is ignored.
+func isMemoryStatCounter(field string) bool {
+	field = strings.TrimPrefix(field, "total_")
+	if slices.Contains(memoryStatGauges, field) {
+		return false
+	}
+	for _, prefix := range memoryStatCounterPrefixes {
+		if strings.HasPrefix(field, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// availableCgroupMetrics creates the configured metrics that can be read from the given cgroup hierarchy.
+func availableCgroupMetrics(configs []CgroupMetricConfig, hierarchy CgroupHierarchy) (available []Metric, unavailable []string) {
+	for _, config := range configs {
+		if hierarchy != CgroupV2 && config.V1File == "" {
+			unavailable = append(unavailable, metricSource(config.File, config.Field))
+			continue
+		}
+		available = append(available, newMetric(config))
+	}
+
+	if hierarchy != CgroupV2 {
+		for _, metric := range cgroupPressureMetrics {
+			unavailable = append(unavailable, metric.cgroupFile)
+		}
+		unavailable = append(unavailable, "io.stat", "memory.numa_stat")
+	}
+
+	return available, unavailable
+}
+
+// builtinMetricNames holds the names of the built-in metrics that are exported regardless of cgroup_metrics.
+// The names are added when the descriptors are created with newBuiltinDesc.
+var builtinMetricNames = make(map[string]bool)
+
+// newBuiltinDesc creates the descriptor of a built-in metric, adding its name to builtinMetricNames.
+func newBuiltinDesc(name, help string, labels []string) *prometheus.Desc {
+	builtinMetricNames[name] = true
+	return prometheus.NewDesc(name, help, labels, nil)
+}
+
+// reservedMetricPrefixes lists the name prefixes of the smaps and process status metrics, and of the metrics of
+// the Go runtime, process and promhttp handler collectors of the default registry.
+var reservedMetricPrefixes = []string{"process_", "go_", "promhttp_"}
+
+// isBuiltinMetricName checks if the metric name is used by a built-in metric, and cannot be used in cgroup_metrics.
+func isBuiltinMetricName(name string) bool {
+	if builtinMetricNames[name] {
+		return true
+	}
+	for _, prefix := range reservedMetricPrefixes {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+var cgroupLabels = []string{"namespace", "pod", "container", "level", "subcgroup", "cgroup_path"}
+
+// Values of the level label of the cgroup metrics.
+// The cgroups of the QoS classes use the QoS class as the level, see qosCgroupLevel.
+const (
+	CgroupLevelContainer = "container"
+	CgroupLevelPod       = "pod"
+	CgroupLevelNode      = "node"
+)
+
+// Built-in cgroup v2 metrics, with their cgroup v1 equivalents where available.
+// They are used as the default of the cgroup_metrics configuration.
+// https://docs.kernel.org/admin-guide/cgroup-v2.html
+// https://docs.kernel.org/admin-guide/cgroup-v1/index.html
+
+var defaultCgroupMetrics = []CgroupMetricConfig{
+	// Memory
+	{
+		Name:   "cgroup_memory_current_bytes",
+		Help:   "Total memory currently used by the cgroup and its descendants, in bytes (from memory.current).",
+		Type:   MetricTypeGauge,
+		File:   "memory.current",
+		V1File: "memory.usage_in_bytes",
 	},
 	{
-		gauge: promauto.NewGaugeVec(
-			prometheus.GaugeOpts{
-				Name: "cgroup_memory_stat_slab_reclaimable_bytes",
-				Help: "Part of slab memory that might be reclaimed, such as dentries and inodes (from memory.stat:slab_reclaimable).",
-			},
-			[]string{"namespace", "pod", "container"},
-		),
-		cgroupFile:      "memory.stat",
-		cgroupFileField: "slab_reclaimable",
+		Name:   "cgroup_memory_peak_bytes",
+		Help:   "Maximum memory usage recorded for the cgroup and its descendants since creation or last reset (from memory.peak).",
+		Type:   MetricTypeGauge,
+		File:   "memory.peak",
+		V1File: "memory.max_usage_in_bytes",
 	},
 	{
-		gauge: promauto.NewGaugeVec(
-			prometheus.GaugeOpts{
-				Name: "cgroup_memory_stat_slab_unreclaimable_bytes",
-				Help: "Part of slab memory that cannot be reclaimed on memory pressure (from memory.stat:slab_unreclaimable).",
-			},
-			[]string{"namespace", "pod", "container"},
-		),
-		cgroupFile:      "memory.stat",
-		cgroupFileField: "slab_unreclaimable",
+		Name: "cgroup_memory_low_bytes",
+		Help: "Best-effort memory protection threshold below which memory is not reclaimed (from memory.low).",
+		Type: MetricTypeGauge,
+		File: "memory.low",
 	},
 	{
-		gauge: promauto.NewGaugeVec(
-			prometheus.GaugeOpts{
-				Name: "cgroup_memory_stat_pagetables_bytes",
-				Help: "Amount of memory allocated for page tables (from memory.stat:pagetables).",
-			},
-			[]string{"namespace", "pod", "container"},
-		),
-		cgroupFile:      "memory.stat",
-		cgroupFileField: "pagetables",
+		Name: "cgroup_memory_high_bytes",
+		Help: "Memory usage throttle limit above which processes are throttled and put under reclaim pressure (from memory.high).",
+		Type: MetricTypeGauge,
+		File: "memory.high",
 	},
 	{
-		gauge: promauto.NewGaugeVec(
-			prometheus.GaugeOpts{
-				Name: "cgroup_memory_stat_kernel_stack_bytes",
-				Help: "Amount of memory allocated to kernel stacks (from memory.stat:kernel_stack).",
-			},
-			[]string{"namespace", "pod", "container"},
-		),
-		cgroupFile:      "memory.stat",
-		cgroupFileField: "kernel_stack",
+		Name: "cgroup_memory_max_bytes",
+		Help: "Hard memory usage limit for the cgroup; exceeding this may trigger OOM killer (from memory.max).",
+		Type: MetricTypeGauge,
+		File: "memory.max",
 	},
 	{
-		gauge: promauto.NewGaugeVec(
-			prometheus.GaugeOpts{
-				Name: "cgroup_memory_stat_active_anon_bytes",
-				Help: "Amount of active anonymous memory on the internal memory management lists (from memory.stat:active_anon).",
-			},
-			[]string{"namespace", "pod", "container"},
-		),
-		cgroupFile:      "memory.stat",
-		cgroupFileField: "active_anon",
+		Name: "cgroup_memory_min_bytes",
+		Help: "Hard memory protection threshold below which memory is not reclaimed under any conditions (from memory.min).",
+		Type: MetricTypeGauge,
+		File: "memory.min",
 	},
 	{
-		gauge: promauto.NewGaugeVec(
-			prometheus.GaugeOpts{
-				Name: "cgroup_memory_stat_inactive_anon_bytes",
-				Help: "Amount of inactive anonymous memory on the internal memory management lists (from memory.stat:inactive_anon).",
-			},
-			[]string{"namespace", "pod", "container"},
-		),
-		cgroupFile:      "memory.stat",
-		cgroupFileField: "inactive_anon",
+		Name: "cgroup_memory_swap_high_bytes",
+		Help: "Swap usage throttle limit above which allocations of the cgroup are throttled (from memory.swap.high).",
+		Type: MetricTypeGauge,
+		File: "memory.swap.high",
 	},
 	{
-		gauge: promauto.NewGaugeVec(
-			prometheus.GaugeOpts{
-				Name: "cgroup_memory_stat_active_file_bytes",
-				Help: "Amount of active file-backed memory on the internal memory management lists (from memory.stat:active_file).",
-			},
-			[]string{"namespace", "pod", "container"},
-		),
-		cgroupFile:      "memory.stat",
-		cgroupFileField: "active_file",
+		Name: "cgroup_memory_swap_max_bytes",
+		Help: "Hard swap usage limit for the cgroup (from memory.swap.max).",
+		Type: MetricTypeGauge,
+		File: "memory.swap.max",
 	},
 	{
-		gauge: promauto.NewGaugeVec(
-			prometheus.GaugeOpts{
-				Name: "cgroup_memory_stat_inactive_file_bytes",
-				Help: "Amount of inactive file-backed memory on the internal memory management lists (from memory.stat:inactive_file).",
-			},
-			[]string{"namespace", "pod", "container"},
-		),
-		cgroupFile:      "memory.stat",
-		cgroupFileField: "inactive_file",
+		Name: "cgroup_memory_swap_current_bytes",
+		Help: "Total amount of swap currently used by the cgroup and its descendants (from memory.swap.current).",
+		Type: MetricTypeGauge,
+		File: "memory.swap.current",
 	},
 	{
-		gauge: promauto.NewGaugeVec(
-			prometheus.GaugeOpts{
-				Name: "cgroup_memory_stat_unevictable_bytes",
-				Help: "Amount of unevictable memory (from memory.stat:unevictable).",
-			},
-			[]string{"namespace", "pod", "container"},
-		),
-		cgroupFile:      "memory.stat",
-		cgroupFileField: "unevictable",
+		Name: "cgroup_memory_swap_peak_bytes",
+		Help: "Maximum swap usage recorded for the cgroup and its descendants since creation or last reset (from memory.swap.peak).",
+		Type: MetricTypeGauge,
+		File: "memory.swap.peak",
 	},
 	{
-		counter: promauto.NewCounterVec(
-			prometheus.CounterOpts{
-				Name: "cgroup_memory_stat_pgfault_total",
-				Help: "Total number of page faults incurred by the cgroup (from memory.stat:pgfault).",
-			},
-			[]string{"namespace", "pod", "container"},
-		),
-		cgroupFile:      "memory.stat",
-		cgroupFileField: "pgfault",
+		Name:  "cgroup_memory_swap_events_high_total",
+		Help:  "Number of times the cgroup swap usage was over the high threshold (from memory.swap.events:high).",
+		Type:  MetricTypeCounter,
+		File:  "memory.swap.events",
+		Field: "high",
 	},
 	{
-		counter: promauto.NewCounterVec(
-			prometheus.CounterOpts{
-				Name: "cgroup_memory_stat_pgmajfault_total",
-				Help: "Number of major page faults incurred by the cgroup (from memory.stat:pgmajfault).",
-			},
-			[]string{"namespace", "pod", "container"},
-		),
-		cgroupFile:      "memory.stat",
-		cgroupFileField: "pgmajfault",
+		Name:  "cgroup_memory_swap_events_max_total",
+		Help:  "Number of times the cgroup swap usage was about to go over the max boundary and swap allocation failed (from memory.swap.events:max).",
+		Type:  MetricTypeCounter,
+		File:  "memory.swap.events",
+		Field: "max",
+	},
+	{
+		Name:  "cgroup_memory_swap_events_fail_total",
+		Help:  "Number of times swap allocation failed either because of running out of swap system-wide or max limit (from memory.swap.events:fail).",
+		Type:  MetricTypeCounter,
+		File:  "memory.swap.events",
+		Field: "fail",
+	},
+	{
+		Name: "cgroup_memory_zswap_current_bytes",
+		Help: "Total amount of memory consumed by the zswap compression backend for the cgroup and its descendants (from memory.zswap.current).",
+		Type: MetricTypeGauge,
+		File: "memory.zswap.current",
+	},
+	{
+		Name: "cgroup_memory_zswap_max_bytes",
+		Help: "Zswap usage hard limit; if the cgroup zswap pool reaches this limit, it refuses to take any more stores (from memory.zswap.max).",
+		Type: MetricTypeGauge,
+		File: "memory.zswap.max",
+	},
+	{
+		Name: "cgroup_memory_zswap_writeback",
+		Help: "Whether pages of the cgroup are written back from zswap to the swap device, 1 if enabled and 0 if disabled (from memory.zswap.writeback).",
+		Type: MetricTypeGauge,
+		File: "memory.zswap.writeback",
+	},
+	{
+		Name: "cgroup_memory_oom_group",
+		Help: "Whether the cgroup is treated as an indivisible workload by the OOM killer, 1 if enabled and 0 if disabled (from memory.oom.group).",
+		Type: MetricTypeGauge,
+		File: "memory.oom.group",
+	},
+	// memory.stat fields
+	{
+		Name:    "cgroup_memory_stat_anon_bytes",
+		Help:    "Amount of memory used in anonymous mappings such as brk(), sbrk(), and mmap(MAP_ANONYMOUS) (from memory.stat:anon).",
+		Type:    MetricTypeGauge,
+		File:    "memory.stat",
+		Field:   "anon",
+		V1File:  "memory.stat",
+		V1Field: "total_rss",
+	},
+	{
+		Name:    "cgroup_memory_stat_file_bytes",
+		Help:    "Amount of memory used to cache filesystem data, including tmpfs and shared memory (from memory.stat:file).",
+		Type:    MetricTypeGauge,
+		File:    "memory.stat",
+		Field:   "file",
+		V1File:  "memory.stat",
+		V1Field: "total_cache",
+	},
+	{
+		Name:    "cgroup_memory_stat_shmem_bytes",
+		Help:    "Amount of cached filesystem data that is swap-backed, such as tmpfs, shm segments, and shared anonymous mmap()s (from memory.stat:shmem).",
+		Type:    MetricTypeGauge,
+		File:    "memory.stat",
+		Field:   "shmem",
+		V1File:  "memory.stat",
+		V1Field: "total_shmem",
+	},
+	{
+		Name:  "cgroup_memory_stat_kernel_bytes",
+		Help:  "Total kernel memory usage, including kernel_stack, pagetables, percpu, vmalloc, and slab (from memory.stat:kernel).",
+		Type:  MetricTypeGauge,
+		File:  "memory.stat",
+		Field: "kernel",
+	},
+	{
+		Name:  "cgroup_memory_stat_slab_bytes",
+		Help:  "Amount of memory used for storing in-kernel data structures (from memory.stat:slab).",
+		Type:  MetricTypeGauge,
+		File:  "memory.stat",
+		Field: "slab",
+	},
+	{
+		Name:  "cgroup_memory_stat_slab_reclaimable_bytes",
+		Help:  "Part of slab memory that might be reclaimed, such as dentries and inodes (from memory.stat:slab_reclaimable).",
+		Type:  MetricTypeGauge,
+		File:  "memory.stat",
+		Field: "slab_reclaimable",
+	},
+	{
+		Name:  "cgroup_memory_stat_slab_unreclaimable_bytes",
+		Help:  "Part of slab memory that cannot be reclaimed on memory pressure (from memory.stat:slab_unreclaimable).",
+		Type:  MetricTypeGauge,
+		File:  "memory.stat",
+		Field: "slab_unreclaimable",
+	},
+	{
+		Name:  "cgroup_memory_stat_pagetables_bytes",
+		Help:  "Amount of memory allocated for page tables (from memory.stat:pagetables).",
+		Type:  MetricTypeGauge,
+		File:  "memory.stat",
+		Field: "pagetables",
+	},
+	{
+		Name:  "cgroup_memory_stat_kernel_stack_bytes",
+		Help:  "Amount of memory allocated to kernel stacks (from memory.stat:kernel_stack).",
+		Type:  MetricTypeGauge,
+		File:  "memory.stat",
+		Field: "kernel_stack",
+	},
+	{
+		Name:    "cgroup_memory_stat_active_anon_bytes",
+		Help:    "Amount of active anonymous memory on the internal memory management lists (from memory.stat:active_anon).",
+		Type:    MetricTypeGauge,
+		File:    "memory.stat",
+		Field:   "active_anon",
+		V1File:  "memory.stat",
+		V1Field: "total_active_anon",
+	},
+	{
+		Name:    "cgroup_memory_stat_inactive_anon_bytes",
+		Help:    "Amount of inactive anonymous memory on the internal memory management lists (from memory.stat:inactive_anon).",
+		Type:    MetricTypeGauge,
+		File:    "memory.stat",
+		Field:   "inactive_anon",
+		V1File:  "memory.stat",
+		V1Field: "total_inactive_anon",
+	},
+	{
+		Name:    "cgroup_memory_stat_active_file_bytes",
+		Help:    "Amount of active file-backed memory on the internal memory management lists (from memory.stat:active_file).",
+		Type:    MetricTypeGauge,
+		File:    "memory.stat",
+		Field:   "active_file",
+		V1File:  "memory.stat",
+		V1Field: "total_active_file",
+	},
+	{
+		Name:    "cgroup_memory_stat_inactive_file_bytes",
+		Help:    "Amount of inactive file-backed memory on the internal memory management lists (from memory.stat:inactive_file).",
+		Type:    MetricTypeGauge,
+		File:    "memory.stat",
+		Field:   "inactive_file",
+		V1File:  "memory.stat",
+		V1Field: "total_inactive_file",
+	},
+	{
+		Name:    "cgroup_memory_stat_unevictable_bytes",
+		Help:    "Amount of unevictable memory (from memory.stat:unevictable).",
+		Type:    MetricTypeGauge,
+		File:    "memory.stat",
+		Field:   "unevictable",
+		V1File:  "memory.stat",
+		V1Field: "total_unevictable",
+	},
+	{
+		Name:    "cgroup_memory_stat_pgfault_total",
+		Help:    "Total number of page faults incurred by the cgroup (from memory.stat:pgfault).",
+		Type:    MetricTypeCounter,
+		File:    "memory.stat",
+		Field:   "pgfault",
+		V1File:  "memory.stat",
+		V1Field: "total_pgfault",
+	},
+	{
+		Name:    "cgroup_memory_stat_pgmajfault_total",
+		Help:    "Number of major page faults incurred by the cgroup (from memory.stat:pgmajfault).",
+		Type:    MetricTypeCounter,
+		File:    "memory.stat",
+		Field:   "pgmajfault",
+		V1File:  "memory.stat",
+		V1Field: "total_pgmajfault",
+	},
+	// memory.events and memory.events.local fields
+	{
+		Name:  "cgroup_memory_events_low_total",
+		Help:  "Number of times the cgroup was reclaimed due to high memory pressure even though its usage was under the low boundary, in the cgroup and its descendants (from memory.events:low).",
+		Type:  MetricTypeCounter,
+		File:  "memory.events",
+		Field: "low",
+	},
+	{
+		Name:  "cgroup_memory_events_high_total",
+		Help:  "Number of times processes of the cgroup were throttled and routed to perform direct memory reclaim because the high memory boundary was exceeded, in the cgroup and its descendants (from memory.events:high).",
+		Type:  MetricTypeCounter,
+		File:  "memory.events",
+		Field: "high",
+	},
+	{
+		Name:  "cgroup_memory_events_max_total",
+		Help:  "Number of times the cgroup memory usage was about to go over the max boundary, in the cgroup and its descendants (from memory.events:max).",
+		Type:  MetricTypeCounter,
+		File:  "memory.events",
+		Field: "max",
+	},
+	{
+		Name:  "cgroup_memory_events_oom_total",
+		Help:  "Number of times the cgroup memory usage reached the limit and allocation was about to fail, in the cgroup and its descendants (from memory.events:oom).",
+		Type:  MetricTypeCounter,
+		File:  "memory.events",
+		Field: "oom",
+	},
+	{
+		Name:    "cgroup_memory_events_oom_kill_total",
+		Help:    "Number of processes belonging to the cgroup killed by any kind of OOM killer, in the cgroup and its descendants (from memory.events:oom_kill).",
+		Type:    MetricTypeCounter,
+		File:    "memory.events",
+		Field:   "oom_kill",
+		V1File:  "memory.oom_control",
+		V1Field: "oom_kill",
+	},
+	{
+		Name:  "cgroup_memory_events_oom_group_kill_total",
+		Help:  "Number of times a group OOM kill has occurred in the cgroup, in the cgroup and its descendants (from memory.events:oom_group_kill).",
+		Type:  MetricTypeCounter,
+		File:  "memory.events",
+		Field: "oom_group_kill",
+	},
+	{
+		Name:  "cgroup_memory_events_local_low_total",
+		Help:  "Number of times the cgroup was reclaimed due to high memory pressure even though its usage was under the low boundary, in the cgroup itself only (from memory.events.local:low).",
+		Type:  MetricTypeCounter,
+		File:  "memory.events.local",
+		Field: "low",
+	},
+	{
+		Name:  "cgroup_memory_events_local_high_total",
+		Help:  "Number of times processes of the cgroup were throttled and routed to perform direct memory reclaim because the high memory boundary was exceeded, in the cgroup itself only (from memory.events.local:high).",
+		Type:  MetricTypeCounter,
+		File:  "memory.events.local",
+		Field: "high",
+	},
+	{
+		Name:  "cgroup_memory_events_local_max_total",
+		Help:  "Number of times the cgroup memory usage was about to go over the max boundary, in the cgroup itself only (from memory.events.local:max).",
+		Type:  MetricTypeCounter,
+		File:  "memory.events.local",
+		Field: "max",
+	},
+	{
+		Name:  "cgroup_memory_events_local_oom_total",
+		Help:  "Number of times the cgroup memory usage reached the limit and allocation was about to fail, in the cgroup itself only (from memory.events.local:oom).",
+		Type:  MetricTypeCounter,
+		File:  "memory.events.local",
+		Field: "oom",
+	},
+	{
+		Name:  "cgroup_memory_events_local_oom_kill_total",
+		Help:  "Number of processes belonging to the cgroup killed by any kind of OOM killer, in the cgroup itself only (from memory.events.local:oom_kill).",
+		Type:  MetricTypeCounter,
+		File:  "memory.events.local",
+		Field: "oom_kill",
+	},
+	{
+		Name:  "cgroup_memory_events_local_oom_group_kill_total",
+		Help:  "Number of times a group OOM kill has occurred in the cgroup, in the cgroup itself only (from memory.events.local:oom_group_kill).",
+		Type:  MetricTypeCounter,
+		File:  "memory.events.local",
+		Field: "oom_group_kill",
 	},
 	// CPU
 	{
-		counter: promauto.NewCounterVec(
-			prometheus.CounterOpts{
-				Name: "cgroup_cpu_usage_usec",
-				Help: "Total CPU time consumed by all processes in the cgroup, in microseconds (from cpu.stat:usage_usec).",
-			},
-			[]string{"namespace", "pod", "container"},
-		),
-		cgroupFile:      "cpu.stat",
-		cgroupFileField: "usage_usec",
+		Name:    "cgroup_cpu_usage_usec",
+		Help:    "Total CPU time consumed by all processes in the cgroup, in microseconds (from cpu.stat:usage_usec).",
+		Type:    MetricTypeCounter,
+		File:    "cpu.stat",
+		Field:   "usage_usec",
+		V1File:  "cpuacct.usage",
+		V1Scale: nanosecondsToMicroseconds,
 	},
 	{
-		counter: promauto.NewCounterVec(
-			prometheus.CounterOpts{
-				Name: "cgroup_cpu_user_usec",
-				Help: "Total user mode CPU time consumed by the cgroup, in microseconds (from cpu.stat:user_usec).",
-			},
-			[]string{"namespace", "pod", "container"},
-		),
-		cgroupFile:      "cpu.stat",
-		cgroupFileField: "user_usec",
+		Name:    "cgroup_cpu_user_usec",
+		Help:    "Total user mode CPU time consumed by the cgroup, in microseconds (from cpu.stat:user_usec).",
+		Type:    MetricTypeCounter,
+		File:    "cpu.stat",
+		Field:   "user_usec",
+		V1File:  "cpuacct.usage_user",
+		V1Scale: nanosecondsToMicroseconds,
 	},
 	{
-		counter: promauto.NewCounterVec(
-			prometheus.CounterOpts{
-				Name: "cgroup_cpu_system_usec",
-				Help: "Total system (kernel) mode CPU time consumed by the cgroup, in microseconds (from cpu.stat:system_usec).",
-			},
-			[]string{"namespace", "pod", "container"},
-		),
-		cgroupFile:      "cpu.stat",
-		cgroupFileField: "system_usec",
+		Name:    "cgroup_cpu_system_usec",
+		Help:    "Total system (kernel) mode CPU time consumed by the cgroup, in microseconds (from cpu.stat:system_usec).",
+		Type:    MetricTypeCounter,
+		File:    "cpu.stat",
+		Field:   "system_usec",
+		V1File:  "cpuacct.usage_sys",
+		V1Scale: nanosecondsToMicroseconds,
 	},
 	{
-		counter: promauto.NewCounterVec(
-			prometheus.CounterOpts{
-				Name: "cgroup_cpu_nr_periods_total",
-				Help: "Number of enforcement intervals (periods) for CPU bandwidth (from cpu.stat:nr_periods).",
-			},
-			[]string{"namespace", "pod", "container"},
-		),
-		cgroupFile:      "cpu.stat",
-		cgroupFileField: "nr_periods",
+		Name:    "cgroup_cpu_nr_periods_total",
+		Help:    "Number of enforcement intervals (periods) for CPU bandwidth (from cpu.stat:nr_periods).",
+		Type:    MetricTypeCounter,
+		File:    "cpu.stat",
+		Field:   "nr_periods",
+		V1File:  "cpu.stat",
+		V1Field: "nr_periods",
 	},
 	{
-		counter: promauto.NewCounterVec(
-			prometheus.CounterOpts{
-				Name: "cgroup_cpu_nr_throttled_total",
-				Help: "Number of periods in which the cgroup was throttled due to CPU quota (from cpu.stat:nr_throttled).",
-			},
-			[]string{"namespace", "pod", "container"},
-		),
-		cgroupFile:      "cpu.stat",
-		cgroupFileField: "nr_throttled",
+		Name:    "cgroup_cpu_nr_throttled_total",
+		Help:    "Number of periods in which the cgroup was throttled due to CPU quota (from cpu.stat:nr_throttled).",
+		Type:    MetricTypeCounter,
+		File:    "cpu.stat",
+		Field:   "nr_throttled",
+		V1File:  "cpu.stat",
+		V1Field: "nr_throttled",
 	},
 	{
-		counter: promauto.NewCounterVec(
-			prometheus.CounterOpts{
-				Name: "cgroup_cpu_throttled_usec_total",
-				Help: "Total time duration in microseconds that the cgroup was throttled due to CPU quota (from cpu.stat:throttled_usec).",
-			},
-			[]string{"namespace", "pod", "container"},
-		),
-		cgroupFile:      "cpu.stat",
-		cgroupFileField: "throttled_usec",
+		Name:    "cgroup_cpu_throttled_usec_total",
+		Help:    "Total time duration in microseconds that the cgroup was throttled due to CPU quota (from cpu.stat:throttled_usec).",
+		Type:    MetricTypeCounter,
+		File:    "cpu.stat",
+		Field:   "throttled_usec",
+		V1File:  "cpu.stat",
+		V1Field: "throttled_time",
+		V1Scale: nanosecondsToMicroseconds,
+	},
+	{
+		Name:   "cgroup_cpu_max_quota_usec",
+		Help:   "CPU bandwidth quota in microseconds the cgroup can use in each period, -1 if unlimited (from first value of cpu.max).",
+		Type:   MetricTypeGauge,
+		File:   "cpu.max",
+		V1File: "cpu.cfs_quota_us",
+	},
+	{
+		Name:   "cgroup_cpu_max_period_usec",
+		Help:   "CPU bandwidth period in microseconds (from second value of cpu.max).",
+		Type:   MetricTypeGauge,
+		File:   "cpu.max",
+		Index:  1,
+		V1File: "cpu.cfs_period_us",
+	},
+	{
+		Name: "cgroup_cpu_weight",
+		Help: "Proportional CPU weight of the cgroup in range 1-10000 (from cpu.weight).",
+		Type: MetricTypeGauge,
+		File: "cpu.weight",
+	},
+	{
+		Name: "cgroup_cpu_weight_nice",
+		Help: "Proportional CPU weight of the cgroup as nice value in range -20-19 (from cpu.weight.nice).",
+		Type: MetricTypeGauge,
+		File: "cpu.weight.nice",
+	},
+	{
+		Name: "cgroup_cpu_idle",
+		Help: "Whether the cgroup has the SCHED_IDLE scheduling policy, 1 if idle and 0 otherwise (from cpu.idle).",
+		Type: MetricTypeGauge,
+		File: "cpu.idle",
 	},
 	// PIDs
 	{
-		gauge: promauto.NewGaugeVec(
-			prometheus.GaugeOpts{
-				Name: "cgroup_pids_current",
-				Help: "Number of processes currently in the cgroup and its descendants (from pids.current).",
-			},
-			[]string{"namespace", "pod", "container"},
-		),
-		cgroupFile: "pids.current",
+		Name:   "cgroup_pids_current",
+		Help:   "Number of processes currently in the cgroup and its descendants (from pids.current).",
+		Type:   MetricTypeGauge,
+		File:   "pids.current",
+		V1File: "pids.current",
 	},
 	{
-		gauge: promauto.NewGaugeVec(
-			prometheus.GaugeOpts{
-				Name: "cgroup_pids_max",
-				Help: "Hard limit on the number of processes allowed in the cgroup (from pids.max).",
-			},
-			[]string{"namespace", "pod", "container"},
-		),
-		cgroupFile: "pids.max",
+		Name:   "cgroup_pids_max",
+		Help:   "Hard limit on the number of processes allowed in the cgroup (from pids.max).",
+		Type:   MetricTypeGauge,
+		File:   "pids.max",
+		V1File: "pids.max",
 	},
 	{
-		gauge: promauto.NewGaugeVec(
-			prometheus.GaugeOpts{
-				Name: "cgroup_pids_peak",
-				Help: "Maximum number of processes ever present in the cgroup and its descendants (from pids.peak).",
-			},
-			[]string{"namespace", "pod", "container"},
-		),
-		cgroupFile: "pids.peak",
+		Name: "cgroup_pids_peak",
+		Help: "Maximum number of processes ever present in the cgroup and its descendants (from pids.peak).",
+		Type: MetricTypeGauge,
+		File: "pids.peak",
+	},
+	{
+		Name:  "cgroup_nr_descendants",
+		Help:  "Number of visible descendant cgroups (from cgroup.stat:nr_descendants).",
+		Type:  MetricTypeGauge,
+		File:  "cgroup.stat",
+		Field: "nr_descendants",
+	},
+	{
+		Name:  "cgroup_nr_dying_descendants",
+		Help:  "Number of dying descendant cgroups, which have been deleted but are still held by the kernel (from cgroup.stat:nr_dying_descendants).",
+		Type:  MetricTypeGauge,
+		File:  "cgroup.stat",
+		Field: "nr_dying_descendants",
+	},
+	{
+		Name:  "cgroup_events_populated",
+		Help:  "Whether the cgroup or its descendants have live processes, 1 if populated and 0 otherwise (from cgroup.events:populated).",
+		Type:  MetricTypeGauge,
+		File:  "cgroup.events",
+		Field: "populated",
+	},
+	{
+		Name:  "cgroup_events_frozen",
+		Help:  "Whether the cgroup is frozen, 1 if frozen and 0 otherwise (from cgroup.events:frozen).",
+		Type:  MetricTypeGauge,
+		File:  "cgroup.events",
+		Field: "frozen",
+	},
+	{
+		Name: "cgroup_freeze",
+		Help: "Whether freezing of the cgroup has been requested, 1 if requested and 0 otherwise (from cgroup.freeze).",
+		Type: MetricTypeGauge,
+		File: "cgroup.freeze",
 	},
 }
 
 // Smaps metrics - enhanced with container labels
 // https://docs.kernel.org/filesystems/proc.html
 
-var (
-	ProcessSmapsSize = promauto.NewGaugeVec(
-		prometheus.GaugeOpts{
-			Name: "process_smaps_size_bytes",
-			Help: "Total size of the memory mapping in bytes (from Size).",
-		},
-		[]string{"namespace", "pod", "container", "host_pid", "ns_pid", "comm", "path"},
-	)
-	ProcessSmapsRss = promauto.NewGaugeVec(
-		prometheus.GaugeOpts{
-			Name: "process_smaps_rss_bytes",
-			Help: "Resident Set Size: amount of the mapping currently resident in RAM (bytes) (from Rss).",
-		},
-		[]string{"namespace", "pod", "container", "host_pid", "ns_pid", "comm", "path"},
-	)
-	ProcessSmapsPss = promauto.NewGaugeVec(
-		prometheus.GaugeOpts{
-			Name: "process_smaps_pss_bytes",
-			Help: "Proportional Set Size: mapping's share of RAM, divided by number of processes sharing each page (bytes) (from Pss).",
-		},
-		[]string{"namespace", "pod", "container", "host_pid", "ns_pid", "comm", "path"},
-	)
-	ProcessSmapsPssDirty = promauto.NewGaugeVec(
-		prometheus.GaugeOpts{
-			Name: "process_smaps_pss_dirty_bytes",
-			Help: "Proportional Set Size of dirty pages in the mapping (bytes) (from Pss_Dirty).",
-		},
-		[]string{"namespace", "pod", "container", "host_pid", "ns_pid", "comm", "path"},
-	)
-	ProcessSmapsSharedClean = promauto.NewGaugeVec(
-		prometheus.GaugeOpts{
-			Name: "process_smaps_shared_clean_bytes",
-			Help: "Amount of clean shared pages in the mapping (bytes) (from Shared_Clean).",
-		},
-		[]string{"namespace", "pod", "container", "host_pid", "ns_pid", "comm", "path"},
-	)
-	ProcessSmapsSharedDirty = promauto.NewGaugeVec(
-		prometheus.GaugeOpts{
-			Name: "process_smaps_shared_dirty_bytes",
-			Help: "Amount of dirty shared pages in the mapping (bytes) (from Shared_Dirty).",
-		},
-		[]string{"namespace", "pod", "container", "host_pid", "ns_pid", "comm", "path"},
-	)
-	ProcessSmapsPrivateClean = promauto.NewGaugeVec(
-		prometheus.GaugeOpts{
-			Name: "process_smaps_private_clean_bytes",
-			Help: "Amount of clean private pages in the mapping (bytes) (from Private_Clean).",
-		},
-		[]string{"namespace", "pod", "container", "host_pid", "ns_pid", "comm", "path"},
-	)
-	ProcessSmapsPrivateDirty = promauto.NewGaugeVec(
-		prometheus.GaugeOpts{
-			Name: "process_smaps_private_dirty_bytes",
-			Help: "Amount of dirty private pages in the mapping (bytes) (from Private_Dirty).",
-		},
-		[]string{"namespace", "pod", "container", "host_pid", "ns_pid", "comm", "path"},
-	)
-	ProcessSmapsReferenced = promauto.NewGaugeVec(
-		prometheus.GaugeOpts{
-			Name: "process_smaps_referenced_bytes",
-			Help: "Amount of memory in the mapping currently marked as referenced or accessed (bytes) (from Referenced).",
-		},
-		[]string{"namespace", "pod", "container", "host_pid", "ns_pid", "comm", "path"},
-	)
-	ProcessSmapsAnonymous = promauto.NewGaugeVec(
-		prometheus.GaugeOpts{
-			Name: "process_smaps_anonymous_bytes",
-			Help: "Amount of memory in the mapping that does not belong to any file (bytes) (from Anonymous).",
-		},
-		[]string{"namespace", "pod", "container", "host_pid", "ns_pid", "comm", "path"},
-	)
-	ProcessSmapsLazyFree = promauto.NewGaugeVec(
-		prometheus.GaugeOpts{
-			Name: "process_smaps_lazyfree_bytes",
-			Help: "Amount of memory in the mapping marked by madvise(MADV_FREE), to be freed under memory pressure (bytes) (from LazyFree).",
-		},
-		[]string{"namespace", "pod", "container", "host_pid", "ns_pid", "comm", "path"},
-	)
-	ProcessSmapsAnonHugePages = promauto.NewGaugeVec(
-		prometheus.GaugeOpts{
-			Name: "process_smaps_anon_hugepages_bytes",
-			Help: "Amount of memory in the mapping backed by transparent hugepages (bytes) (from AnonHugePages).",
-		},
-		[]string{"namespace", "pod", "container", "host_pid", "ns_pid", "comm", "path"},
-	)
-	ProcessSmapsShmemPmdMapped = promauto.NewGaugeVec(
-		prometheus.GaugeOpts{
-			Name: "process_smaps_shmem_pmdmapped_bytes",
-			Help: "Amount of shared (shmem/tmpfs) memory in the mapping backed by huge pages (bytes) (from ShmemPmdMapped).",
-		},
-		[]string{"namespace", "pod", "container", "host_pid", "ns_pid", "comm", "path"},
-	)
-	ProcessSmapsSharedHugetlb = promauto.NewGaugeVec(
-		prometheus.GaugeOpts{
-			Name: "process_smaps_shared_hugetlb_bytes",
-			Help: "Amount of memory in the mapping backed by hugetlbfs pages and shared (bytes) (from Shared_Hugetlb).",
-		},
-		[]string{"namespace", "pod", "container", "host_pid", "ns_pid", "comm", "path"},
-	)
-	ProcessSmapsPrivateHugetlb = promauto.NewGaugeVec(
-		prometheus.GaugeOpts{
-			Name: "process_smaps_private_hugetlb_bytes",
-			Help: "Amount of memory in the mapping backed by hugetlbfs pages and private (bytes) (from Private_Hugetlb).",
-		},
-		[]string{"namespace", "pod", "container", "host_pid", "ns_pid", "comm", "path"},
-	)
-	ProcessSmapsSwap = promauto.NewGaugeVec(
-		prometheus.GaugeOpts{
-			Name: "process_smaps_swap_bytes",
-			Help: "Amount of would-be-anonymous memory in the mapping that is swapped out (bytes) (from Swap).",
-		},
-		[]string{"namespace", "pod", "container", "host_pid", "ns_pid", "comm", "path"},
-	)
-	ProcessSmapsSwapPss = promauto.NewGaugeVec(
-		prometheus.GaugeOpts{
-			Name: "process_smaps_swap_pss_bytes",
-			Help: "Proportional share of swap space used by the mapping (bytes) (from SwapPss).",
-		},
-		[]string{"namespace", "pod", "container", "host_pid", "ns_pid", "comm", "path"},
-	)
-	ProcessSmapsKernelPageSize = promauto.NewGaugeVec(
-		prometheus.GaugeOpts{
-			Name: "process_smaps_kernel_page_size_bytes",
-			Help: "Kernel page size used for the mapping (bytes) (from KernelPageSize).",
-		},
-		[]string{"namespace", "pod", "container", "host_pid", "ns_pid", "comm", "path"},
-	)
-	ProcessSmapsMMUPageSize = promauto.NewGaugeVec(
-		prometheus.GaugeOpts{
-			Name: "process_smaps_mmu_page_size_bytes",
-			Help: "MMU page size used for the mapping (bytes) (from MMUPageSize).",
-		},
-		[]string{"namespace", "pod", "container", "host_pid", "ns_pid", "comm", "path"},
-	)
-	ProcessSmapsLocked = promauto.NewGaugeVec(
-		prometheus.GaugeOpts{
-			Name: "process_smaps_locked_bytes",
-			Help: "Amount of memory in the mapping that is locked in RAM (bytes) (from Locked).",
-		},
-		[]string{"namespace", "pod", "container", "host_pid", "ns_pid", "comm", "path"},
-	)
-)
+// processLabels are the labels of the per-process metrics. The smaps metrics have the per-mapping labels in addition.
+var processLabels = []string{"namespace", "pod", "container", "host_pid", "ns_pid", "comm"}
+
+// SmapsMetrics holds the smaps metric vectors. Their labels depend on the smaps_aggregation configuration,
+// see smapsAggregationLabels.
+type SmapsMetrics struct {
+	Size           *prometheus.GaugeVec
+	Rss            *prometheus.GaugeVec
+	Pss            *prometheus.GaugeVec
+	PssDirty       *prometheus.GaugeVec
+	SharedClean    *prometheus.GaugeVec
+	SharedDirty    *prometheus.GaugeVec
+	PrivateClean   *prometheus.GaugeVec
+	PrivateDirty   *prometheus.GaugeVec
+	Referenced     *prometheus.GaugeVec
+	Anonymous      *prometheus.GaugeVec
+	LazyFree       *prometheus.GaugeVec
+	AnonHugePages  *prometheus.GaugeVec
+	ShmemPmdMapped *prometheus.GaugeVec
+	SharedHugetlb  *prometheus.GaugeVec
+	PrivateHugetlb *prometheus.GaugeVec
+	Swap           *prometheus.GaugeVec
+	SwapPss        *prometheus.GaugeVec
+	KernelPageSize *prometheus.GaugeVec
+	MMUPageSize    *prometheus.GaugeVec
+	Locked         *prometheus.GaugeVec
+}
+
+func NewSmapsMetrics(aggregation string) *SmapsMetrics {
+	labels := append(slices.Clone(processLabels), smapsAggregationLabels(aggregation)...)
+	newGaugeVec := func(name, help string) *prometheus.GaugeVec {
+		return prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: name, Help: help}, labels)
+	}
+
+	return &SmapsMetrics{
+		Size:           newGaugeVec("process_smaps_size_bytes", "Total size of the memory mapping in bytes (from Size)."),
+		Rss:            newGaugeVec("process_smaps_rss_bytes", "Resident Set Size: amount of the mapping currently resident in RAM (bytes) (from Rss)."),
+		Pss:            newGaugeVec("process_smaps_pss_bytes", "Proportional Set Size: mapping's share of RAM, divided by number of processes sharing each page (bytes) (from Pss)."),
+		PssDirty:       newGaugeVec("process_smaps_pss_dirty_bytes", "Proportional Set Size of dirty pages in the mapping (bytes) (from Pss_Dirty)."),
+		SharedClean:    newGaugeVec("process_smaps_shared_clean_bytes", "Amount of clean shared pages in the mapping (bytes) (from Shared_Clean)."),
+		SharedDirty:    newGaugeVec("process_smaps_shared_dirty_bytes", "Amount of dirty shared pages in the mapping (bytes) (from Shared_Dirty)."),
+		PrivateClean:   newGaugeVec("process_smaps_private_clean_bytes", "Amount of clean private pages in the mapping (bytes) (from Private_Clean)."),
+		PrivateDirty:   newGaugeVec("process_smaps_private_dirty_bytes", "Amount of dirty private pages in the mapping (bytes) (from Private_Dirty)."),
+		Referenced:     newGaugeVec("process_smaps_referenced_bytes", "Amount of memory in the mapping currently marked as referenced or accessed (bytes) (from Referenced)."),
+		Anonymous:      newGaugeVec("process_smaps_anonymous_bytes", "Amount of memory in the mapping that does not belong to any file (bytes) (from Anonymous)."),
+		LazyFree:       newGaugeVec("process_smaps_lazyfree_bytes", "Amount of memory in the mapping marked by madvise(MADV_FREE), to be freed under memory pressure (bytes) (from LazyFree)."),
+		AnonHugePages:  newGaugeVec("process_smaps_anon_hugepages_bytes", "Amount of memory in the mapping backed by transparent hugepages (bytes) (from AnonHugePages)."),
+		ShmemPmdMapped: newGaugeVec("process_smaps_shmem_pmdmapped_bytes", "Amount of shared (shmem/tmpfs) memory in the mapping backed by huge pages (bytes) (from ShmemPmdMapped)."),
+		SharedHugetlb:  newGaugeVec("process_smaps_shared_hugetlb_bytes", "Amount of memory in the mapping backed by hugetlbfs pages and shared (bytes) (from Shared_Hugetlb)."),
+		PrivateHugetlb: newGaugeVec("process_smaps_private_hugetlb_bytes", "Amount of memory in the mapping backed by hugetlbfs pages and private (bytes) (from Private_Hugetlb)."),
+		Swap:           newGaugeVec("process_smaps_swap_bytes", "Amount of would-be-anonymous memory in the mapping that is swapped out (bytes) (from Swap)."),
+		SwapPss:        newGaugeVec("process_smaps_swap_pss_bytes", "Proportional share of swap space used by the mapping (bytes) (from SwapPss)."),
+		KernelPageSize: newGaugeVec("process_smaps_kernel_page_size_bytes", "Kernel page size used for the mapping (bytes) (from KernelPageSize)."),
+		MMUPageSize:    newGaugeVec("process_smaps_mmu_page_size_bytes", "MMU page size used for the mapping (bytes) (from MMUPageSize)."),
+		Locked:         newGaugeVec("process_smaps_locked_bytes", "Amount of memory in the mapping that is locked in RAM (bytes) (from Locked)."),
+	}
+}
+
+// all lists all smaps metric vectors. They are collected by Collector and their series of
+// exited processes are removed by SeriesTracker.
+func (m *SmapsMetrics) all() []*prometheus.GaugeVec {
+	return []*prometheus.GaugeVec{
+		m.Size,
+		m.Rss,
+		m.Pss,
+		m.PssDirty,
+		m.SharedClean,
+		m.SharedDirty,
+		m.PrivateClean,
+		m.PrivateDirty,
+		m.Referenced,
+		m.Anonymous,
+		m.LazyFree,
+		m.AnonHugePages,
+		m.ShmemPmdMapped,
+		m.SharedHugetlb,
+		m.PrivateHugetlb,
+		m.Swap,
+		m.SwapPss,
+		m.KernelPageSize,
+		m.MMUPageSize,
+		m.Locked,
+	}
+}
+
+// SmapsRollupMetrics holds the smaps_rollup metric vectors, totals of all mappings of the process
+// without the per-mapping labels.
+// https://docs.kernel.org/filesystems/proc.html
+type SmapsRollupMetrics struct {
+	Rss            *prometheus.GaugeVec
+	Pss            *prometheus.GaugeVec
+	PssDirty       *prometheus.GaugeVec
+	SharedClean    *prometheus.GaugeVec
+	SharedDirty    *prometheus.GaugeVec
+	PrivateClean   *prometheus.GaugeVec
+	PrivateDirty   *prometheus.GaugeVec
+	Referenced     *prometheus.GaugeVec
+	Anonymous      *prometheus.GaugeVec
+	LazyFree       *prometheus.GaugeVec
+	AnonHugePages  *prometheus.GaugeVec
+	ShmemPmdMapped *prometheus.GaugeVec
+	SharedHugetlb  *prometheus.GaugeVec
+	PrivateHugetlb *prometheus.GaugeVec
+	Swap           *prometheus.GaugeVec
+	SwapPss        *prometheus.GaugeVec
+	Locked         *prometheus.GaugeVec
+}
+
+func NewSmapsRollupMetrics() *SmapsRollupMetrics {
+	newGaugeVec := func(name, help string) *prometheus.GaugeVec {
+		return prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: name, Help: help}, processLabels)
+	}
+
+	return &SmapsRollupMetrics{
+		Rss:            newGaugeVec("process_smaps_rollup_rss_bytes", "Resident Set Size: amount of memory of the process currently resident in RAM (bytes) (from Rss)."),
+		Pss:            newGaugeVec("process_smaps_rollup_pss_bytes", "Proportional Set Size: process's share of RAM, divided by number of processes sharing each page (bytes) (from Pss)."),
+		PssDirty:       newGaugeVec("process_smaps_rollup_pss_dirty_bytes", "Proportional Set Size of dirty pages of the process (bytes) (from Pss_Dirty)."),
+		SharedClean:    newGaugeVec("process_smaps_rollup_shared_clean_bytes", "Amount of clean shared pages of the process (bytes) (from Shared_Clean)."),
+		SharedDirty:    newGaugeVec("process_smaps_rollup_shared_dirty_bytes", "Amount of dirty shared pages of the process (bytes) (from Shared_Dirty)."),
+		PrivateClean:   newGaugeVec("process_smaps_rollup_private_clean_bytes", "Amount of clean private pages of the process (bytes) (from Private_Clean)."),
+		PrivateDirty:   newGaugeVec("process_smaps_rollup_private_dirty_bytes", "Amount of dirty private pages of the process (bytes) (from Private_Dirty)."),
+		Referenced:     newGaugeVec("process_smaps_rollup_referenced_bytes", "Amount of memory of the process currently marked as referenced or accessed (bytes) (from Referenced)."),
+		Anonymous:      newGaugeVec("process_smaps_rollup_anonymous_bytes", "Amount of memory of the process that does not belong to any file (bytes) (from Anonymous)."),
+		LazyFree:       newGaugeVec("process_smaps_rollup_lazyfree_bytes", "Amount of memory of the process marked by madvise(MADV_FREE), to be freed under memory pressure (bytes) (from LazyFree)."),
+		AnonHugePages:  newGaugeVec("process_smaps_rollup_anon_hugepages_bytes", "Amount of memory of the process backed by transparent hugepages (bytes) (from AnonHugePages)."),
+		ShmemPmdMapped: newGaugeVec("process_smaps_rollup_shmem_pmdmapped_bytes", "Amount of shared (shmem/tmpfs) memory of the process backed by huge pages (bytes) (from ShmemPmdMapped)."),
+		SharedHugetlb:  newGaugeVec("process_smaps_rollup_shared_hugetlb_bytes", "Amount of memory of the process backed by hugetlbfs pages and shared (bytes) (from Shared_Hugetlb)."),
+		PrivateHugetlb: newGaugeVec("process_smaps_rollup_private_hugetlb_bytes", "Amount of memory of the process backed by hugetlbfs pages and private (bytes) (from Private_Hugetlb)."),
+		Swap:           newGaugeVec("process_smaps_rollup_swap_bytes", "Amount of would-be-anonymous memory of the process that is swapped out (bytes) (from Swap)."),
+		SwapPss:        newGaugeVec("process_smaps_rollup_swap_pss_bytes", "Proportional share of swap space used by the process (bytes) (from SwapPss)."),
+		Locked:         newGaugeVec("process_smaps_rollup_locked_bytes", "Amount of memory of the process that is locked in RAM (bytes) (from Locked)."),
+	}
+}
+
+// all lists all smaps_rollup metric vectors. They are collected by Collector and their series of
+// exited processes are removed by SeriesTracker.
+func (m *SmapsRollupMetrics) all() []*prometheus.GaugeVec {
+	return []*prometheus.GaugeVec{
+		m.Rss,
+		m.Pss,
+		m.PssDirty,
+		m.SharedClean,
+		m.SharedDirty,
+		m.PrivateClean,
+		m.PrivateDirty,
+		m.Referenced,
+		m.Anonymous,
+		m.LazyFree,
+		m.AnonHugePages,
+		m.ShmemPmdMapped,
+		m.SharedHugetlb,
+		m.PrivateHugetlb,
+		m.Swap,
+		m.SwapPss,
+		m.Locked,
+	}
+}
+
+// Process status metrics, read from /proc/<pid>/status when discovering the processes of the containers.
+// https://docs.kernel.org/filesystems/proc.html
+
+// ProcessStatusMetric describes a value of ProcessStatus exported as a const metric.
+type ProcessStatusMetric struct {
+	desc      *prometheus.Desc
+	valueType prometheus.ValueType
+	value     func(s *ProcessStatus) int64
+}
+
+var processStatusMetrics = []ProcessStatusMetric{
+	{
+		desc:      prometheus.NewDesc("process_status_vm_rss_bytes", "Resident set size of the process (from VmRSS).", processLabels, nil),
+		valueType: prometheus.GaugeValue,
+		value:     func(s *ProcessStatus) int64 { return s.VmRSS },
+	},
+	{
+		desc:      prometheus.NewDesc("process_status_rss_anon_bytes", "Size of resident anonymous memory of the process (from RssAnon).", processLabels, nil),
+		valueType: prometheus.GaugeValue,
+		value:     func(s *ProcessStatus) int64 { return s.RssAnon },
+	},
+	{
+		desc:      prometheus.NewDesc("process_status_rss_file_bytes", "Size of resident file mappings of the process (from RssFile).", processLabels, nil),
+		valueType: prometheus.GaugeValue,
+		value:     func(s *ProcessStatus) int64 { return s.RssFile },
+	},
+	{
+		desc:      prometheus.NewDesc("process_status_rss_shmem_bytes", "Size of resident shared memory of the process, including SysV shm, tmpfs and shared anonymous mappings (from RssShmem).", processLabels, nil),
+		valueType: prometheus.GaugeValue,
+		value:     func(s *ProcessStatus) int64 { return s.RssShmem },
+	},
+	{
+		desc:      prometheus.NewDesc("process_status_vm_hwm_bytes", "Peak resident set size of the process (from VmHWM).", processLabels, nil),
+		valueType: prometheus.GaugeValue,
+		value:     func(s *ProcessStatus) int64 { return s.VmHWM },
+	},
+	{
+		desc:      prometheus.NewDesc("process_status_vm_swap_bytes", "Amount of swap used by anonymous private memory of the process (from VmSwap).", processLabels, nil),
+		valueType: prometheus.GaugeValue,
+		value:     func(s *ProcessStatus) int64 { return s.VmSwap },
+	},
+	{
+		desc:      prometheus.NewDesc("process_status_vm_pte_bytes", "Size of the page table entries of the process (from VmPTE).", processLabels, nil),
+		valueType: prometheus.GaugeValue,
+		value:     func(s *ProcessStatus) int64 { return s.VmPTE },
+	},
+	{
+		desc:      prometheus.NewDesc("process_status_threads", "Number of threads of the process (from Threads).", processLabels, nil),
+		valueType: prometheus.GaugeValue,
+		value:     func(s *ProcessStatus) int64 { return s.Threads },
+	},
+	{
+		desc:      prometheus.NewDesc("process_status_voluntary_ctxt_switches_total", "Number of voluntary context switches of the process (from voluntary_ctxt_switches).", processLabels, nil),
+		valueType: prometheus.CounterValue,
+		value:     func(s *ProcessStatus) int64 { return s.VoluntaryCtxtSwitches },
+	},
+	{
+		desc:      prometheus.NewDesc("process_status_nonvoluntary_ctxt_switches_total", "Number of involuntary context switches of the process (from nonvoluntary_ctxt_switches).", processLabels, nil),
+		valueType: prometheus.CounterValue,
+		value:     func(s *ProcessStatus) int64 { return s.NonvoluntaryCtxtSwitches },
+	},
+}
@@ -0,0 +1,25 @@
+package main
+
+import "testing"
+
+func TestIsMemoryStatCounter(t *testing.T) {
+	tests := []struct {
+		field string
+		want  bool
+	}{
+		{"pgfault", true},
+		{"total_pgmajfault", true},
+		{"workingset_refault_anon", true},
+		{"workingset_nodes", false},
+		{"total_workingset_nodes", false},
+		{"thp_fault_alloc", true},
+		{"anon", false},
+		{"file_mapped", false},
+	}
+
+	for _, tt := range tests {
+		if got := isMemoryStatCounter(tt.field); got != tt.want {
+			t.Errorf("isMemoryStatCounter(%q) = %v, want %v", tt.field, got, tt.want)
+		}
+	}
+}
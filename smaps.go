@@ -2,16 +2,16 @@ package main
 
 import (
 	"bufio"
+	"bytes"
 	"fmt"
 	"io"
 	"regexp"
-	"strconv"
-	"strings"
+	"sync"
 )
 
 // SmapsMapping describes a memory mapping entry parsed from smaps.
-// The AddrRange field is omitted
-// Aggregation is performed by (perms, path)
+// Mappings with the same aggregation keys are summed, see smapsAggregationLabels.
+// The header fields are those of the first mapping of the aggregate.
 type SmapsMapping struct {
 	// Header fields
 	AddrRange string
@@ -20,6 +20,7 @@ type SmapsMapping struct {
 	Dev       string
 	Inode     string
 	Path      string
+	Category  string
 
 	// Key-Value fields (all values in bytes)
 	SizeBytes           int64
@@ -44,114 +45,306 @@ type SmapsMapping struct {
 	LockedBytes         int64
 }
 
-var (
-	// AddrRange                 Perms Offset  Dev    Inode                     Path
-	// 7d4337f0f000-7d4337f10000 rw-p 0002d000 00:2bc 42926480                  /usr/lib/x86_64-linux-gnu/ld-2.31.so
-	headerRe = regexp.MustCompile(`^([0-9a-fA-F]+-[0-9a-fA-F]+) ([rwxps-]{4}) ([0-9a-fA-F]+) ([0-9a-fA-F:]+) (\d+)(?:\s+(.*))?$`)
+// The smaps file has a header line for each mapping, followed by its fields:
+//
+//	AddrRange                 Perms Offset  Dev    Inode                     Path
+//	7d4337f0f000-7d4337f10000 rw-p 0002d000 00:2bc 42926480                  /usr/lib/x86_64-linux-gnu/ld-2.31.so
+//	Size:                  4 kB
+//	...
+//
+// The parser works on the bytes of the lines in the buffer of a pooled bufio.Reader, so that
+// strings are allocated only for the header fields of new aggregates.
 
-	// Key: Value kB
-	// Size:                  4 kB
-	kvRe = regexp.MustCompile(`^([A-Za-z_]+):\s+(\d+) kB`)
+// smapsParser holds the buffers reused between parses.
+type smapsParser struct {
+	reader *bufio.Reader
+	// long holds a line that does not fit in the buffer of the reader.
+	long []byte
+	// key holds the aggregation key of the current mapping.
+	key []byte
+}
+
+var smapsParserPool = sync.Pool{
+	New: func() any {
+		return &smapsParser{reader: bufio.NewReaderSize(nil, 64*1024)}
+	},
+}
+
+func getSmapsParser(r io.Reader) *smapsParser {
+	p := smapsParserPool.Get().(*smapsParser)
+	p.reader.Reset(r)
+	return p
+}
+
+func (p *smapsParser) release() {
+	p.reader.Reset(nil)
+	smapsParserPool.Put(p)
+}
+
+// readLine returns the next line without the line terminator, or io.EOF at the end of input.
+// The line is valid until the next call.
+func (p *smapsParser) readLine() ([]byte, error) {
+	line, err := p.reader.ReadSlice('\n')
+	if err == bufio.ErrBufferFull {
+		p.long = append(p.long[:0], line...)
+		for err == bufio.ErrBufferFull {
+			line, err = p.reader.ReadSlice('\n')
+			p.long = append(p.long, line...)
+		}
+		line = p.long
+	}
+	if err == io.EOF && len(line) > 0 {
+		// Last line without a line terminator.
+		err = nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	line = bytes.TrimSuffix(line, []byte("\n"))
+	line = bytes.TrimSuffix(line, []byte("\r"))
+	return line, nil
+}
+
+// smapsHeader holds the fields of a mapping header line, pointing to the line.
+type smapsHeader struct {
+	addrRange, perms, offset, dev, inode, path []byte
+}
+
+// parseSmapsHeader parses a mapping header line. The path is empty for anonymous mappings.
+func parseSmapsHeader(line []byte) (h smapsHeader, ok bool) {
+	rest := line
+	if h.addrRange, rest, ok = cutSmapsField(rest, isAddrRangeByte, true); !ok {
+		return h, false
+	}
+	start, end, found := bytes.Cut(h.addrRange, []byte("-"))
+	if !found || len(start) == 0 || len(end) == 0 || bytes.IndexByte(end, '-') >= 0 {
+		return h, false
+	}
+	if h.perms, rest, ok = cutSmapsField(rest, isPermsByte, true); !ok || len(h.perms) != 4 {
+		return h, false
+	}
+	if h.offset, rest, ok = cutSmapsField(rest, isHexByte, true); !ok {
+		return h, false
+	}
+	if h.dev, rest, ok = cutSmapsField(rest, isDevByte, true); !ok {
+		return h, false
+	}
+	if h.inode, rest, ok = cutSmapsField(rest, isDigitByte, false); !ok {
+		return h, false
+	}
+
+	// The path is separated from the inode by whitespace.
+	if len(rest) > 0 {
+		if !isSpaceByte(rest[0]) {
+			return h, false
+		}
+		h.path = bytes.TrimSpace(rest)
+	}
+	return h, true
+}
+
+// parseSmapsField parses a field line such as "Size:    4 kB", returning the value in kB.
+// Lines of fields without a kB value, such as VmFlags, are not parsed.
+func parseSmapsField(line []byte) (key []byte, value int64, ok bool) {
+	i := 0
+	for i < len(line) && isKeyByte(line[i]) {
+		i++
+	}
+	if i == 0 || i == len(line) || line[i] != ':' {
+		return nil, 0, false
+	}
+	key = line[:i]
+
+	i++
+	spaces := i
+	for i < len(line) && isSpaceByte(line[i]) {
+		i++
+	}
+	if i == spaces {
+		return nil, 0, false
+	}
+
+	digits := i
+	for i < len(line) && isDigitByte(line[i]) {
+		value = value*10 + int64(line[i]-'0')
+		i++
+	}
+	if i == digits || !bytes.HasPrefix(line[i:], []byte(" kB")) {
+		return nil, 0, false
+	}
+
+	return key, value, true
+}
+
+// cutSmapsField returns the non-empty leading run of bytes accepted by valid, and the rest of the line.
+// If separated is true, the field must be followed by a single space, which is removed from the rest.
+func cutSmapsField(line []byte, valid func(byte) bool, separated bool) (field, rest []byte, ok bool) {
+	i := 0
+	for i < len(line) && valid(line[i]) {
+		i++
+	}
+	if i == 0 {
+		return nil, nil, false
+	}
+	if !separated {
+		return line[:i], line[i:], true
+	}
+	if i == len(line) || line[i] != ' ' {
+		return nil, nil, false
+	}
+	return line[:i], line[i+1:], true
+}
+
+func isHexByte(b byte) bool {
+	return '0' <= b && b <= '9' || 'a' <= b && b <= 'f' || 'A' <= b && b <= 'F'
+}
+
+func isDigitByte(b byte) bool {
+	return '0' <= b && b <= '9'
+}
+
+func isAddrRangeByte(b byte) bool {
+	return isHexByte(b) || b == '-'
+}
+
+func isDevByte(b byte) bool {
+	return isHexByte(b) || b == ':'
+}
+
+func isPermsByte(b byte) bool {
+	switch b {
+	case 'r', 'w', 'x', 'p', 's', '-':
+		return true
+	}
+	return false
+}
+
+func isKeyByte(b byte) bool {
+	return 'a' <= b && b <= 'z' || 'A' <= b && b <= 'Z' || b == '_'
+}
+
+// isSpaceByte matches the whitespace between the header fields and the path.
+func isSpaceByte(b byte) bool {
+	switch b {
+	case ' ', '\t', '\n', '\f', '\r':
+		return true
+	}
+	return false
+}
+
+// Smaps aggregation modes.
+const (
+	SmapsAggregationPath      = "path"
+	SmapsAggregationPermsPath = "perms+path"
+	SmapsAggregationCategory  = "category"
+	SmapsAggregationNone      = "none"
+)
+
+// Categories of memory mappings.
+const (
+	SmapsCategoryHeap    = "heap"
+	SmapsCategoryStack   = "stack"
+	SmapsCategoryVdso    = "vdso"
+	SmapsCategoryAnon    = "anon"
+	SmapsCategoryFile    = "file"
+	SmapsCategoryShm     = "shm"
+	SmapsCategoryDeleted = "deleted"
 )
 
-// ParseSmaps parses the contents of a /proc/[pid]/smaps file.
-func ParseSmaps(r io.Reader) ([]*SmapsMapping, error) {
+// smapsAggregationLabels returns the labels of the smaps metrics that hold the aggregation keys.
+func smapsAggregationLabels(aggregation string) []string {
+	switch aggregation {
+	case SmapsAggregationPermsPath:
+		return []string{"perms", "path"}
+	case SmapsAggregationCategory:
+		return []string{"category"}
+	case SmapsAggregationNone:
+		return []string{"address", "perms", "path"}
+	}
+	return []string{"path"}
+}
+
+// aggregationKeys returns the values of the aggregation keys of the mapping, in the order of smapsAggregationLabels.
+func (m *SmapsMapping) aggregationKeys(aggregation string) []string {
+	switch aggregation {
+	case SmapsAggregationPermsPath:
+		return []string{m.Perms, m.Path}
+	case SmapsAggregationCategory:
+		return []string{m.Category}
+	case SmapsAggregationNone:
+		return []string{m.AddrRange, m.Perms, m.Path}
+	}
+	return []string{m.Path}
+}
+
+// smapsCategory classifies a mapping by its path.
+func smapsCategory(path []byte) string {
+	switch {
+	case string(path) == "[heap]":
+		return SmapsCategoryHeap
+	case bytes.HasPrefix(path, []byte("[stack")):
+		return SmapsCategoryStack
+	case string(path) == "[vdso]" || string(path) == "[vvar]" || string(path) == "[vsyscall]":
+		return SmapsCategoryVdso
+	case bytes.HasPrefix(path, []byte("/dev/shm/")) || bytes.HasPrefix(path, []byte("/SYSV")) || bytes.HasPrefix(path, []byte("/memfd:")):
+		return SmapsCategoryShm
+	case bytes.HasSuffix(path, []byte(" (deleted)")):
+		return SmapsCategoryDeleted
+	case bytes.HasPrefix(path, []byte("/")):
+		return SmapsCategoryFile
+	}
+	return SmapsCategoryAnon
+}
+
+// PathRule rewrites the path of smaps mappings by replacing the matches of Regex with Replacement.
+type PathRule struct {
+	Regex       *regexp.Regexp
+	Replacement string
+}
+
+// rewritePath applies all rules to the path in order.
+func rewritePath(path string, rules []PathRule) string {
+	for _, rule := range rules {
+		path = rule.Regex.ReplaceAllString(path, rule.Replacement)
+	}
+	return path
+}
+
+// ParseSmaps parses the contents of a /proc/[pid]/smaps file, aggregating the mappings by the
+// keys of the given smaps aggregation mode. The path rules are applied before aggregation, so
+// mappings whose paths are rewritten to the same path are summed.
+func ParseSmaps(r io.Reader, aggregation string, rules []PathRule) ([]*SmapsMapping, error) {
+	p := getSmapsParser(r)
+	defer p.release()
+
 	aggregatedSmaps := make(map[string]*SmapsMapping)
 
-	scanner := bufio.NewScanner(r)
 	var mapping *SmapsMapping
-	for scanner.Scan() {
-		line := scanner.Text()
-		if line == "" {
+	for {
+		line, err := p.readLine()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("scan error: %w", err)
+		}
+		if len(line) == 0 {
 			continue
 		}
 
-		if matches := headerRe.FindStringSubmatch(line); matches != nil {
+		if header, ok := parseSmapsHeader(line); ok {
 			// Start a new mapping
-
-			perms := "----"
-			if matches[2] != "" {
-				perms = matches[2]
-			}
-			path := "[anon]"
-			if matches[6] != "" {
-				path = matches[6]
-			}
-
-			tmp := &SmapsMapping{
-				AddrRange: matches[1],
-				Perms:     perms,
-				Offset:    matches[3],
-				Dev:       matches[4],
-				Inode:     matches[5],
-				Path:      strings.TrimSpace(path),
-			}
-
-			// Use path as the aggregation key.
-			key := tmp.Path
-
-			if existing, found := aggregatedSmaps[key]; found {
-				mapping = existing
-			} else {
-				aggregatedSmaps[key] = tmp
-				mapping = tmp
-			}
-
+			mapping = p.aggregate(aggregatedSmaps, &header, aggregation, rules)
 			continue
 		}
 
-		if kv := kvRe.FindStringSubmatch(line); kv != nil {
-			key := kv[1]
-			val, _ := strconv.ParseInt(kv[2], 10, 64)
-			valBytes := val * 1024
-			switch key {
-			case "Size":
-				mapping.SizeBytes += valBytes
-			case "KernelPageSize":
-				mapping.KernelPageSizeBytes += valBytes
-			case "MMUPageSize":
-				mapping.MMUPageSizeBytes += valBytes
-			case "Rss":
-				mapping.RssBytes += valBytes
-			case "Pss":
-				mapping.PssBytes += valBytes
-			case "Pss_Dirty":
-				mapping.PssDirtyBytes += valBytes
-			case "Shared_Clean":
-				mapping.SharedCleanBytes += valBytes
-			case "Shared_Dirty":
-				mapping.SharedDirtyBytes += valBytes
-			case "Private_Clean":
-				mapping.PrivateCleanBytes += valBytes
-			case "Private_Dirty":
-				mapping.PrivateDirtyBytes += valBytes
-			case "Referenced":
-				mapping.ReferencedBytes += valBytes
-			case "Anonymous":
-				mapping.AnonymousBytes += valBytes
-			case "LazyFree":
-				mapping.LazyFreeBytes += valBytes
-			case "AnonHugePages":
-				mapping.AnonHugePagesBytes += valBytes
-			case "ShmemPmdMapped":
-				mapping.ShmemPmdMappedBytes += valBytes
-			case "Shared_Hugetlb":
-				mapping.SharedHugetlbBytes += valBytes
-			case "Private_Hugetlb":
-				mapping.PrivateHugetlbBytes += valBytes
-			case "Swap":
-				mapping.SwapBytes += valBytes
-			case "SwapPss":
-				mapping.SwapPssBytes += valBytes
-			case "Locked":
-				mapping.LockedBytes += valBytes
-			}
-
+		if mapping == nil {
+			continue
+		}
+		if key, value, ok := parseSmapsField(line); ok {
+			mapping.add(key, value*1024)
 		}
-	}
-
-	if err := scanner.Err(); err != nil {
-		return nil, fmt.Errorf("scan error: %w", err)
 	}
 
 	// Convert map to slice
@@ -162,3 +355,117 @@ func ParseSmaps(r io.Reader) ([]*SmapsMapping, error) {
 
 	return result, nil
 }
+
+// aggregate returns the aggregate of the mapping, creating it if this is the first mapping with its aggregation keys.
+func (p *smapsParser) aggregate(aggregatedSmaps map[string]*SmapsMapping, header *smapsHeader, aggregation string, rules []PathRule) *SmapsMapping {
+	path := header.path
+	if len(path) == 0 {
+		path = []byte("[anon]")
+	}
+
+	// The category is based on the original path, e.g. to tell deleted files apart.
+	category := smapsCategory(path)
+	if len(rules) > 0 {
+		path = []byte(rewritePath(string(path), rules))
+	}
+
+	// The key is built in a reused buffer, and looking it up in the map does not allocate.
+	p.key = p.key[:0]
+	switch aggregation {
+	case SmapsAggregationPermsPath:
+		p.key = append(append(append(p.key, header.perms...), 0xff), path...)
+	case SmapsAggregationCategory:
+		p.key = append(p.key, category...)
+	case SmapsAggregationNone:
+		p.key = append(append(append(append(append(p.key, header.addrRange...), 0xff), header.perms...), 0xff), path...)
+	default:
+		p.key = append(p.key, path...)
+	}
+
+	if existing, found := aggregatedSmaps[string(p.key)]; found {
+		return existing
+	}
+
+	mapping := &SmapsMapping{
+		AddrRange: string(header.addrRange),
+		Perms:     string(header.perms),
+		Offset:    string(header.offset),
+		Dev:       string(header.dev),
+		Inode:     string(header.inode),
+		Path:      string(path),
+		Category:  category,
+	}
+	aggregatedSmaps[string(p.key)] = mapping
+	return mapping
+}
+
+// ParseSmapsRollup parses the contents of a /proc/[pid]/smaps_rollup file, which has the totals of
+// all mappings of the process. The header fields of the returned mapping are not set.
+// Size, KernelPageSize and MMUPageSize are not included in smaps_rollup.
+func ParseSmapsRollup(r io.Reader) (*SmapsMapping, error) {
+	p := getSmapsParser(r)
+	defer p.release()
+
+	mapping := &SmapsMapping{}
+	for {
+		line, err := p.readLine()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("scan error: %w", err)
+		}
+
+		if key, value, ok := parseSmapsField(line); ok {
+			mapping.add(key, value*1024)
+		}
+	}
+
+	return mapping, nil
+}
+
+// add adds the value in bytes of the smaps field to the mapping.
+func (m *SmapsMapping) add(key []byte, valBytes int64) {
+	switch string(key) {
+	case "Size":
+		m.SizeBytes += valBytes
+	case "KernelPageSize":
+		m.KernelPageSizeBytes += valBytes
+	case "MMUPageSize":
+		m.MMUPageSizeBytes += valBytes
+	case "Rss":
+		m.RssBytes += valBytes
+	case "Pss":
+		m.PssBytes += valBytes
+	case "Pss_Dirty":
+		m.PssDirtyBytes += valBytes
+	case "Shared_Clean":
+		m.SharedCleanBytes += valBytes
+	case "Shared_Dirty":
+		m.SharedDirtyBytes += valBytes
+	case "Private_Clean":
+		m.PrivateCleanBytes += valBytes
+	case "Private_Dirty":
+		m.PrivateDirtyBytes += valBytes
+	case "Referenced":
+		m.ReferencedBytes += valBytes
+	case "Anonymous":
+		m.AnonymousBytes += valBytes
+	case "LazyFree":
+		m.LazyFreeBytes += valBytes
+	case "AnonHugePages":
+		m.AnonHugePagesBytes += valBytes
+	case "ShmemPmdMapped":
+		m.ShmemPmdMappedBytes += valBytes
+	case "Shared_Hugetlb":
+		m.SharedHugetlbBytes += valBytes
+	case "Private_Hugetlb":
+		m.PrivateHugetlbBytes += valBytes
+	case "Swap":
+		m.SwapBytes += valBytes
+	case "SwapPss":
+		m.SwapPssBytes += valBytes
+	case "Locked":
+		m.LockedBytes += valBytes
+	}
+}
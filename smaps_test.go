@@ -0,0 +1,244 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// The regular expression based parser that ParseSmaps replaced, kept as a reference for fuzzing and benchmarking.
+var (
+	regexpSmapsHeaderRe = regexp.MustCompile(`^([0-9a-fA-F]+-[0-9a-fA-F]+) ([rwxps-]{4}) ([0-9a-fA-F]+) ([0-9a-fA-F:]+) (\d+)(?:\s+(.*))?$`)
+	regexpSmapsFieldRe  = regexp.MustCompile(`^([A-Za-z_]+):\s+(\d+) kB`)
+)
+
+func regexpParseSmaps(r io.Reader, aggregation string, rules []PathRule) ([]*SmapsMapping, error) {
+	aggregatedSmaps := make(map[string]*SmapsMapping)
+
+	scanner := bufio.NewScanner(r)
+	var mapping *SmapsMapping
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			continue
+		}
+
+		if matches := regexpSmapsHeaderRe.FindStringSubmatch(line); matches != nil {
+			path := "[anon]"
+			if matches[6] != "" {
+				path = matches[6]
+			}
+
+			tmp := &SmapsMapping{
+				AddrRange: matches[1],
+				Perms:     matches[2],
+				Offset:    matches[3],
+				Dev:       matches[4],
+				Inode:     matches[5],
+				Path:      strings.TrimSpace(path),
+			}
+			tmp.Category = smapsCategory([]byte(tmp.Path))
+			tmp.Path = rewritePath(tmp.Path, rules)
+
+			key := seriesKey(tmp.aggregationKeys(aggregation))
+			if existing, found := aggregatedSmaps[key]; found {
+				mapping = existing
+			} else {
+				aggregatedSmaps[key] = tmp
+				mapping = tmp
+			}
+			continue
+		}
+
+		if kv := regexpSmapsFieldRe.FindStringSubmatch(line); kv != nil {
+			val, _ := strconv.ParseInt(kv[2], 10, 64)
+			mapping.add([]byte(kv[1]), val*1024)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("scan error: %w", err)
+	}
+
+	result := make([]*SmapsMapping, 0, len(aggregatedSmaps))
+	for _, m := range aggregatedSmaps {
+		result = append(result, m)
+	}
+	return result, nil
+}
+
+const testSmaps = `55d1c4a00000-55d1c4a21000 r--p 00000000 08:01 1234567                    /usr/bin/java
+Size:                132 kB
+KernelPageSize:        4 kB
+MMUPageSize:           4 kB
+Rss:                 120 kB
+Pss:                  60 kB
+Pss_Dirty:             0 kB
+Shared_Clean:        120 kB
+Shared_Dirty:          0 kB
+Private_Clean:         0 kB
+Private_Dirty:         0 kB
+Referenced:          120 kB
+Anonymous:             0 kB
+LazyFree:              0 kB
+AnonHugePages:         0 kB
+ShmemPmdMapped:        0 kB
+FilePmdMapped:         0 kB
+Shared_Hugetlb:        0 kB
+Private_Hugetlb:       0 kB
+Swap:                  0 kB
+SwapPss:               0 kB
+Locked:                0 kB
+THPeligible:    0
+VmFlags: rd mr mw me sd
+55d1c5a00000-55d1c5a42000 rw-p 00000000 00:00 0                          [heap]
+Size:                264 kB
+Rss:                 200 kB
+Pss:                 200 kB
+Private_Dirty:       200 kB
+Anonymous:           200 kB
+7f3a10000000-7f3a10021000 rw-p 00000000 00:00 0
+Size:                132 kB
+Rss:                   8 kB
+Anonymous:             8 kB
+7f3a20000000-7f3a20400000 rw-s 00000000 00:05 4242                       /dev/shm/buffer (deleted)
+Size:               4096 kB
+Rss:                1024 kB
+Shared_Dirty:       1024 kB
+7ffd8a1f0000-7ffd8a211000 rw-p 00000000 00:00 0                          [stack]
+Size:                132 kB
+Rss:                  16 kB
+Private_Dirty:        16 kB
+Anonymous:            16 kB
+`
+
+// syntheticSmaps returns an smaps file of the given number of mappings, resembling those of a JVM with
+// many anonymous mappings and mapped files.
+func syntheticSmaps(mappings int) []byte {
+	var b bytes.Buffer
+	for i := range mappings {
+		start := 0x7f0000000000 + uint64(i)*0x21000
+		var path string
+		switch i % 4 {
+		case 0:
+			path = fmt.Sprintf("/usr/lib/jvm/lib/lib%d.so", i%200)
+		case 1:
+			path = "[heap]"
+		case 2:
+			path = ""
+		case 3:
+			path = fmt.Sprintf("/tmp/perf-%d.map (deleted)", i%50)
+		}
+		fmt.Fprintf(&b, "%x-%x rw-p 00000000 08:01 %d                    %s\n", start, start+0x21000, i, path)
+		for _, field := range []string{"Size", "KernelPageSize", "MMUPageSize", "Rss", "Pss", "Pss_Dirty",
+			"Shared_Clean", "Shared_Dirty", "Private_Clean", "Private_Dirty", "Referenced", "Anonymous",
+			"LazyFree", "AnonHugePages", "ShmemPmdMapped", "FilePmdMapped", "Shared_Hugetlb",
+			"Private_Hugetlb", "Swap", "SwapPss", "Locked"} {
+			fmt.Fprintf(&b, "%-16s%8d kB\n", field+":", (i*7)%1024)
+		}
+		b.WriteString("THPeligible:    0\n")
+		b.WriteString("VmFlags: rd wr mr mw me ac sd\n")
+	}
+	return b.Bytes()
+}
+
+// sortedMappings orders the mappings by their fields, since the parsers return them in map order.
+func sortedMappings(mappings []*SmapsMapping) []*SmapsMapping {
+	sort.Slice(mappings, func(i, j int) bool {
+		return fmt.Sprint(*mappings[i]) < fmt.Sprint(*mappings[j])
+	})
+	return mappings
+}
+
+func TestParseSmaps(t *testing.T) {
+	mappings, err := ParseSmaps(strings.NewReader(testSmaps), SmapsAggregationCategory, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := make(map[string]int64)
+	for _, m := range mappings {
+		got[m.Category] = m.RssBytes
+	}
+	want := map[string]int64{
+		SmapsCategoryFile:  120 * 1024,
+		SmapsCategoryHeap:  200 * 1024,
+		SmapsCategoryAnon:  8 * 1024,
+		SmapsCategoryShm:   1024 * 1024,
+		SmapsCategoryStack: 16 * 1024,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func BenchmarkParseSmaps(b *testing.B) {
+	data := syntheticSmaps(5000)
+	for _, parser := range []struct {
+		name  string
+		parse func(io.Reader, string, []PathRule) ([]*SmapsMapping, error)
+	}{
+		{"bytes", ParseSmaps},
+		{"regexp", regexpParseSmaps},
+	} {
+		for _, aggregation := range []string{SmapsAggregationPath, SmapsAggregationNone} {
+			b.Run(parser.name+"/"+aggregation, func(b *testing.B) {
+				b.ReportAllocs()
+				b.SetBytes(int64(len(data)))
+				for b.Loop() {
+					if _, err := parser.parse(bytes.NewReader(data), aggregation, nil); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		}
+	}
+}
+
+// FuzzParseSmaps checks that ParseSmaps returns the same mappings as the regular expression based parser.
+func FuzzParseSmaps(f *testing.F) {
+	f.Add([]byte(testSmaps))
+	f.Add([]byte("00400000-00401000 r-xp 00000000 fd:01 42\tpath with  spaces \r\nRss:\t4 kB\n"))
+
+	rules := []PathRule{{Regex: regexp.MustCompile(` \(deleted\)$`)}}
+	aggregations := []string{SmapsAggregationPath, SmapsAggregationPermsPath, SmapsAggregationCategory, SmapsAggregationNone}
+	overflowRe := regexp.MustCompile(`\d{19}`)
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		// Values that overflow int64 are clamped by strconv but wrap in ParseSmaps.
+		if overflowRe.Match(data) {
+			t.Skip()
+		}
+
+		for _, aggregation := range aggregations {
+			want, err := func() (mappings []*SmapsMapping, err error) {
+				// The reference parser panics on a field line before the first header.
+				defer func() {
+					if recover() != nil {
+						err = fmt.Errorf("panic")
+					}
+				}()
+				return regexpParseSmaps(bytes.NewReader(data), aggregation, rules)
+			}()
+			if err != nil {
+				// The reference parser also fails on lines longer than the bufio.Scanner buffer.
+				t.Skip()
+			}
+
+			got, err := ParseSmaps(bytes.NewReader(data), aggregation, rules)
+			if err != nil {
+				t.Fatalf("aggregation %s: %v", aggregation, err)
+			}
+			if !reflect.DeepEqual(sortedMappings(got), sortedMappings(want)) {
+				t.Errorf("aggregation %s: got %+v, want %+v", aggregation, got, want)
+			}
+		}
+	})
+}